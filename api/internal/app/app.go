@@ -1,11 +1,17 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/bus/natsbus"
+	"nanonime/internal/pkg/cache"
 	"nanonime/internal/pkg/config"
 	"nanonime/internal/pkg/database"
 	"nanonime/internal/pkg/logger"
+	_middleware "nanonime/internal/pkg/middleware"
+	"nanonime/internal/pkg/migrate"
 	"nanonime/internal/pkg/server"
 	_validator "nanonime/internal/pkg/validator"
 	"time"
@@ -17,21 +23,34 @@ import (
 
 // App represents the application
 type App struct {
+	cfg     *config.Config
 	db      *gorm.DB
 	server  *server.ServerContext
 	modules []Module
 	r       *echo.Echo
 	logger  *logger.Logger
+	event   *bus.EventBus
+	outbox  *bus.Outbox
+	cache   cache.Store
+	// invalidator evicts cached data on the events declared by modules
+	invalidator *cache.Invalidator
+	// watcher reloads the configuration while running
+	watcher     *config.Watcher
+	cors        *_middleware.CORS
+	rateLimiter *_middleware.RateLimiter
 }
 
-// NewApp creates a new application
-func NewApp(cfg *logger.Config) (*App, error) {
-	appLogger, err := logger.NewLogger(*cfg, config.GetString("server.app_name"))
+// NewApp creates a new application from a loaded configuration
+func NewApp(cfg *config.Config) (*App, error) {
+	appLogger, err := logger.NewLogger(cfg.Log, cfg.Server.AppName)
 	if err != nil {
 		return nil, err
 	}
 	defer appLogger.Sync()
+	// secrets are redacted when the configuration is printed
+	appLogger.Debug("Configuration loaded", "file", cfg.File, "config", cfg)
 	return &App{
+		cfg:     cfg,
 		modules: make([]Module, 0),
 		logger:  appLogger,
 	}, nil
@@ -51,25 +70,69 @@ func (a *App) RegisterModule(module Module) {
 func (a *App) Initialize() error {
 	a.logger.Info("Initializing application...")
 
+	if err := a.prepareModules(); err != nil {
+		return err
+	}
+
 	// Initialize database
-	var err *error
-	a.db, err = a.SetDatabase().OpenDB()
-	if err != nil {
-		a.logger.Error("Failed to initialize database: %v", err)
-		return *err
+	db, dbErr := a.SetDatabase().OpenDB()
+	if dbErr != nil {
+		a.logger.Error("Failed to initialize database: %v", *dbErr)
+		return *dbErr
 	}
+	a.db = db
 
 	// Set database instance for all modules
 	database.DB = a.db
 
+	// Apply pending migrations, a failed migration stops the startup
+	if a.cfg.Database.MigrateOnStart {
+		migrator, err := a.SetMigrator()
+		if err != nil {
+			a.logger.Error("Failed to register migrations: %v", err)
+			return err
+		}
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			a.logger.Error("Failed to apply migrations: %v", err)
+			return err
+		}
+		a.logger.Info("Migrations applied", "count", applied)
+	}
+
 	// event bus initialization
-	event := bus.NewEventBus()
+	busCfg, err := a.SetEventBus()
+	if err != nil {
+		a.logger.Error("Failed to configure event bus: %v", err)
+		return err
+	}
+	a.event = bus.NewEventBusWithConfig(busCfg, a.logger.WithPrefix("bus"))
+	if err := a.SetOutbox(); err != nil {
+		a.logger.Error("Failed to initialize event outbox: %v", err)
+		return err
+	}
+
+	// cache initialization
+	a.cache, err = a.SetCache()
+	if err != nil {
+		a.logger.Error("Failed to initialize cache: %v", err)
+		return err
+	}
+	_middleware.InitializeCache(a.cache, time.Duration(a.cfg.Cache.HTTPTTLSeconds)*time.Second)
+	a.invalidator = cache.NewInvalidator(a.event, _middleware.PurgeCache, a.logger.WithPrefix("cache"))
 
 	// initialize router
 	a.r = a.SetRouter()
+	a.r.Use(_middleware.Trace)
 	a.r.Use(middleware.Logger())
 	a.r.Use(middleware.Recover())
-	a.r.Use(middleware.CORS())
+	if err := _middleware.SetTrustedProxies(a.cfg.Server.TrustedProxies); err != nil {
+		return err
+	}
+	a.cors = _middleware.NewCORS(a.cfg.Server.CORSOrigins)
+	a.r.Use(a.cors.Middleware())
+	a.rateLimiter = _middleware.NewRateLimiter(a.cfg.Server.RateLimit, a.cfg.Server.RateBurst)
+	a.r.Use(a.rateLimiter.Middleware())
 
 	// validate request
 	a.r.Validator = _validator.NewCustomValidator()
@@ -80,28 +143,29 @@ func (a *App) Initialize() error {
 
 		// Create module-specific logger
 		moduleLogger := a.logger.WithPrefix(module.Name())
-		if err := module.Initialize(a.db, moduleLogger, event); err != nil {
+		if cached, ok := module.(CacheModule); ok {
+			cached.UseCache(a.cache)
+		}
+		if err := module.Initialize(a.db, moduleLogger, a.event); err != nil {
 			a.logger.Error("Failed to initialize module %s: %v", module.Name(), err)
 			return err
 		}
+		if invalidating, ok := module.(CacheInvalidatingModule); ok {
+			invalidating.DeclareInvalidations(a.invalidator)
+		}
 
 		a.logger.Info("Module initialized: %s", module.Name())
 	}
 
-	// Run migrations for all modules
-	for _, module := range a.modules {
-		err := module.Migrations()
-		if err != nil {
-			a.logger.Error("Failed to run migrations for module %s: %v", module.Name(), err)
-		}
-		a.logger.Info("Migrations completed for module: %s", module.Name())
-	}
-
 	// Initialize HTTP server
-	a.server = a.SetServer()
+	a.server, err = a.SetServer()
+	if err != nil {
+		a.logger.Error("Failed to configure server: %v", err)
+		return err
+	}
 
 	// api version
-	version := fmt.Sprintf("/api/v%s", config.GetString("server.api_version"))
+	version := fmt.Sprintf("/api/v%s", a.cfg.Server.APIVersion)
 
 	// Register routes for all modules
 	for _, module := range a.modules {
@@ -113,6 +177,10 @@ func (a *App) Initialize() error {
 	// append handler to server
 	a.server.Handler = a.r
 
+	// reload selected settings on configuration changes
+	a.watcher = config.NewWatcher(a.cfg, a.logger.WithPrefix("config"))
+	a.watcher.OnReload(a.reload)
+
 	a.logger.Info("Application initialization completed")
 
 	for _, v := range a.r.Routes() {
@@ -122,33 +190,348 @@ func (a *App) Initialize() error {
 	return nil
 }
 
-// Start starts the application
-func (a *App) Start() {
-	a.logger.Info("Starting server on %s", a.server.Host)
-	a.server.Run()
+// Start starts the application and blocks until the server has stopped and
+// the application has been shut down
+func (a *App) Start() error {
+	if a.outbox != nil {
+		a.logger.Info("Starting event outbox relay")
+		a.outbox.Start()
+	}
+	a.watcher.Watch()
+
+	var runErr error
+	if a.cfg.Server.TLSEnabled {
+		a.logger.Info("Starting HTTPS server on %s", a.server.Host)
+		runErr = a.server.RunWithSSL()
+	} else {
+		a.logger.Info("Starting server on %s", a.server.Host)
+		runErr = a.server.Run()
+	}
+	if runErr != nil {
+		a.logger.Error("Server stopped with error: %v", runErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.server.ShutdownTimeout)
+	defer cancel()
+
+	return errors.Join(runErr, a.Stop(ctx))
+}
+
+// Stop releases the application's resources in reverse initialization order.
+// The outbox relay is stopped and queued events are drained first so their
+// handlers still run against live modules, then modules are stopped, the event
+// bus is closed and finally the database pool is closed.
+func (a *App) Stop(ctx context.Context) error {
+	a.logger.Info("Stopping application...")
+
+	var errs []error
+
+	if a.watcher != nil {
+		a.watcher.Close()
+	}
+
+	if a.outbox != nil {
+		if err := a.outbox.Stop(ctx); err != nil {
+			a.logger.Error("Failed to stop event outbox relay: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if a.event != nil {
+		if err := a.waitForEvents(ctx); err != nil {
+			a.logger.Error("Failed to drain event bus: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if a.invalidator != nil {
+		a.invalidator.Close()
+	}
+
+	for i := len(a.modules) - 1; i >= 0; i-- {
+		module, ok := a.modules[i].(StoppableModule)
+		if !ok {
+			continue
+		}
+
+		a.logger.Info("Stopping module: %s", module.Name())
+		if err := module.Stop(ctx); err != nil {
+			a.logger.Error("Failed to stop module %s: %v", module.Name(), err)
+			errs = append(errs, fmt.Errorf("stop module %s: %w", module.Name(), err))
+		}
+	}
+
+	if a.event != nil {
+		a.event.Close()
+		a.logger.Info("Event bus closed")
+	}
+
+	if a.cache != nil {
+		if err := a.cache.Close(); err != nil {
+			a.logger.Error("Failed to close cache: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if a.db != nil {
+		sqlDB, err := a.db.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		if err != nil {
+			a.logger.Error("Failed to close database: %v", err)
+			errs = append(errs, err)
+		} else {
+			a.logger.Info("Database connection closed")
+		}
+	}
+
+	a.logger.Info("Application stopped")
+	a.logger.Sync()
+
+	return errors.Join(errs...)
+}
+
+// prepareModules drops the disabled modules, configures the others and
+// orders them by dependency
+func (a *App) prepareModules() error {
+	// Drop the modules disabled under [modules.<name>]
+	modules, disabled, err := enabledModules(a.modules, a.cfg.ModuleEnabled)
+	if err != nil {
+		a.logger.Error("Failed to resolve enabled modules: %v", err)
+		return err
+	}
+	for _, name := range disabled {
+		a.logger.Info("Module disabled: %s", name)
+	}
+
+	// Configure modules before opening any resource, so every invalid
+	// setting is reported at once
+	if err := a.configureModules(modules); err != nil {
+		a.logger.Error("Failed to configure modules: %v", err)
+		return err
+	}
+
+	// Resolve module initialization order
+	modules, err = sortModules(modules)
+	if err != nil {
+		a.logger.Error("Failed to resolve module dependencies: %v", err)
+		return err
+	}
+	a.modules = modules
+
+	for _, module := range a.modules {
+		a.logger.Debug("Module order: %s (depends on: %v)", module.Name(), moduleDependencies(module))
+	}
+	return nil
+}
+
+// configureModules hands the configuration to the modules and reports the
+// errors of all of them, and the sections of unknown modules
+func (a *App) configureModules(modules []Module) error {
+	known := make(map[string]bool, len(a.modules))
+	for _, module := range a.modules {
+		known[module.Name()] = true
+	}
+	for _, name := range a.cfg.Modules() {
+		if !known[name] {
+			a.logger.Warn("Configuration for unknown module ignored", "section", "modules."+name)
+		}
+	}
+
+	var errs []error
+	for _, module := range modules {
+		if configurable, ok := module.(ConfigurableModule); ok {
+			if err := configurable.Configure(a.cfg); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// reload applies the settings that can change while running and notifies
+// the modules
+func (a *App) reload(cfg *config.Config, changed []string) {
+	a.logger.SetLevel(cfg.Log.Level)
+	cache.SetDefaultTTL(a.cache, time.Duration(cfg.Server.CacheExpired)*time.Minute)
+	_middleware.SetCacheTTL(time.Duration(cfg.Cache.HTTPTTLSeconds) * time.Second)
+	a.cors.SetOrigins(cfg.Server.CORSOrigins)
+	if err := _middleware.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		a.logger.Error("Failed to apply trusted proxies: %v", err)
+	}
+	a.rateLimiter.SetLimit(cfg.Server.RateLimit, cfg.Server.RateBurst)
+
+	for _, module := range a.modules {
+		if reloadable, ok := module.(ReloadableModule); ok {
+			reloadable.Reload(cfg, changed)
+		}
+	}
+
+	// Every instance reloads its own file, so the event stays in this process
+	bus.PublishLocal(a.event, config.Reloaded{Changed: changed})
+}
+
+// waitForEvents waits for queued events to be handled or for ctx to expire
+func (a *App) waitForEvents(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		a.event.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("pending events not processed: %w", ctx.Err())
+	}
 }
 
 // setup database model
 func (a *App) SetDatabase() *database.DBModel {
 	return &database.DBModel{
-		ServerMode:   config.GetString("server.mode"),
-		Driver:       config.GetString("database.db_driver"),
-		Host:         config.GetString("database.db_host"),
-		Port:         config.GetString("database.db_port"),
-		Name:         config.GetString("database.db_name"),
-		Username:     config.GetString("database.db_username"),
-		Password:     config.GetString("database.db_password"),
-		MaxIdleConn:  config.GetInt("pool.conn_idle"),
-		MaxOpenConn:  config.GetInt("pool.conn_max"),
-		ConnLifeTime: config.GetInt("pool.conn_lifetime"),
+		ServerMode:   a.cfg.Server.Mode,
+		Driver:       a.cfg.Database.Driver,
+		Host:         a.cfg.Database.Host,
+		Port:         a.cfg.Database.Port,
+		Name:         a.cfg.Database.Name,
+		Username:     a.cfg.Database.Username,
+		Password:     a.cfg.Database.Password.Reveal(),
+		MaxIdleConn:  a.cfg.Pool.ConnIdle,
+		MaxOpenConn:  a.cfg.Pool.ConnMax,
+		ConnLifeTime: a.cfg.Pool.ConnLifetime,
 	}
 }
 
+// setup event bus configuration and connect its transport
+func (a *App) SetEventBus() (bus.Config, error) {
+	cfg := bus.DefaultConfig()
+	cfg.QueueSize = a.cfg.Bus.QueueSize
+	cfg.Workers = a.cfg.Bus.Workers
+	cfg.HandlerTimeout = time.Duration(a.cfg.Bus.HandlerTimeout) * time.Second
+	cfg.RequestTimeout = time.Duration(a.cfg.Bus.RequestTimeout) * time.Second
+
+	switch a.cfg.Bus.Transport {
+	case "memory":
+	case "nats":
+		t, err := natsbus.Connect(a.cfg.Bus.NatsURL.Reveal(), natsbus.Options{
+			SubjectPrefix: a.cfg.Bus.NatsSubjectPrefix,
+			Name:          a.cfg.Server.AppName,
+		})
+		if err != nil {
+			return cfg, err
+		}
+		a.logger.Info("Event bus connected to NATS")
+		cfg.Transport = t
+	default:
+		return cfg, fmt.Errorf("unknown bus transport %q, expected memory or nats", a.cfg.Bus.Transport)
+	}
+
+	return cfg, nil
+}
+
+// setup the persistent event outbox when bus.mode is "outbox"
+func (a *App) SetOutbox() error {
+	switch a.cfg.Bus.Mode {
+	case "memory":
+		return nil
+	case "outbox":
+	default:
+		return fmt.Errorf("unknown bus mode %q, expected memory or outbox", a.cfg.Bus.Mode)
+	}
+
+	cfg := bus.DefaultOutboxConfig()
+	cfg.PollInterval = time.Duration(a.cfg.Bus.OutboxPollIntervalMs) * time.Millisecond
+	cfg.BatchSize = a.cfg.Bus.OutboxBatchSize
+	cfg.MaxAttempts = a.cfg.Bus.OutboxMaxAttempts
+	cfg.RetryBackoff = time.Duration(a.cfg.Bus.OutboxRetryBackoff) * time.Second
+	cfg.MaxRetryBackoff = time.Duration(a.cfg.Bus.OutboxMaxRetryBackoff) * time.Second
+	cfg.ClaimTimeout = time.Duration(a.cfg.Bus.OutboxClaimTimeout) * time.Second
+
+	outbox := bus.NewOutbox(a.db, a.event, cfg)
+
+	a.outbox = outbox
+	a.event.UseOutbox(outbox)
+	a.logger.Info("Event bus running in outbox mode")
+	return nil
+}
+
+// setup the cache store from cache.driver, "memory" or "redis". Entries
+// cached without a TTL expire after server.cache_expired minutes,
+// server.cache_purged is the cleanup interval of the memory store in minutes.
+func (a *App) SetCache() (cache.Store, error) {
+	ttl := time.Duration(a.cfg.Server.CacheExpired) * time.Minute
+
+	switch a.cfg.Cache.Driver {
+	case "memory":
+		cleanup := time.Duration(a.cfg.Server.CachePurged) * time.Minute
+		return cache.WithDefaultTTL(cache.NewMemoryStore(cleanup), ttl), nil
+	case "redis":
+		store, err := cache.NewRedisStore(a.cfg.Cache.RedisURL.Reveal(), a.cfg.Cache.KeyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := store.Ping(ctx); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("connect to redis: %w", err)
+		}
+		a.logger.Info("Cache connected to Redis")
+		return cache.WithDefaultTTL(store, ttl), nil
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q, expected memory or redis", a.cfg.Cache.Driver)
+	}
+}
+
+// setup the migrator with the outbox migrations followed by the migrations
+// of every module in dependency order
+func (a *App) SetMigrator() (*migrate.Migrator, error) {
+	migrator := migrate.New(a.db, a.logger.WithPrefix("migrate"), migrate.Options{
+		LockName:    a.cfg.Database.Name + ".schema_migrations",
+		LockTimeout: time.Duration(a.cfg.Database.MigrateLockTimeout) * time.Second,
+	})
+
+	if err := migrator.Register("bus", bus.OutboxMigrations()...); err != nil {
+		return nil, err
+	}
+	for _, module := range a.modules {
+		if err := migrator.Register(module.Name(), module.Migrations()...); err != nil {
+			return nil, err
+		}
+	}
+	return migrator, nil
+}
+
 // Setup Web Server
-func (a *App) SetServer() *server.ServerContext {
-	return &server.ServerContext{
-		Host:         ":" + config.GetString("server.port"),
-		ReadTimeout:  time.Duration(config.GetInt("server.http_timeout")),
-		WriteTimeout: time.Duration(config.GetInt("server.http_timeout")),
+func (a *App) SetServer() (*server.ServerContext, error) {
+	s := &server.ServerContext{
+		Host:            ":" + a.cfg.Server.Port,
+		ReadTimeout:     time.Duration(a.cfg.Server.HTTPTimeout) * time.Second,
+		WriteTimeout:    time.Duration(a.cfg.Server.HTTPTimeout) * time.Second,
+		ShutdownTimeout: time.Duration(a.cfg.Server.ShutdownTimeout) * time.Second,
 	}
+
+	if !a.cfg.Server.TLSEnabled {
+		return s, nil
+	}
+
+	minVersion, err := server.ParseTLSVersion(a.cfg.Server.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Logger = a.logger
+	s.CertFile = a.cfg.Server.TLSCertFile
+	s.KeyFile = a.cfg.Server.TLSKeyFile
+	s.MinTLSVersion = minVersion
+	if a.cfg.Server.TLSRedirectPort != "" {
+		s.RedirectHost = ":" + a.cfg.Server.TLSRedirectPort
+	}
+
+	return s, nil
 }
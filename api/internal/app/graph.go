@@ -0,0 +1,110 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// moduleDependencies returns the declared dependencies of a module
+func moduleDependencies(module Module) []string {
+	if dependent, ok := module.(DependentModule); ok {
+		return dependent.Dependencies()
+	}
+	return nil
+}
+
+// sortModules orders modules so that every module comes after the modules it
+// depends on. Modules without a dependency relation keep their registration
+// order. It fails on duplicate names, missing dependencies and cycles.
+func sortModules(modules []Module) ([]Module, error) {
+	index := make(map[string]int, len(modules))
+	for i, module := range modules {
+		if _, exists := index[module.Name()]; exists {
+			return nil, fmt.Errorf("module %s registered more than once", module.Name())
+		}
+		index[module.Name()] = i
+	}
+
+	for _, module := range modules {
+		for _, dep := range moduleDependencies(module) {
+			if _, exists := index[dep]; !exists {
+				return nil, fmt.Errorf("module %s depends on unregistered module %s", module.Name(), dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(modules))
+	sorted := make([]Module, 0, len(modules))
+	path := make([]string, 0, len(modules))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		module := modules[i]
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path[indexOf(path, module.Name()):], module.Name())
+			return fmt.Errorf("module dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[i] = visiting
+		path = append(path, module.Name())
+		for _, dep := range moduleDependencies(module) {
+			if err := visit(index[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+
+		sorted = append(sorted, module)
+		return nil
+	}
+
+	for i := range modules {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// enabledModules drops the modules for which enabled returns false. It fails
+// when an enabled module depends on a disabled one.
+func enabledModules(modules []Module, enabled func(name string) bool) (kept []Module, disabled []string, err error) {
+	off := make(map[string]bool)
+	for _, module := range modules {
+		if enabled(module.Name()) {
+			kept = append(kept, module)
+		} else {
+			off[module.Name()] = true
+			disabled = append(disabled, module.Name())
+		}
+	}
+
+	for _, module := range kept {
+		for _, dep := range moduleDependencies(module) {
+			if off[dep] {
+				return nil, nil, fmt.Errorf("module %s depends on disabled module %s", module.Name(), dep)
+			}
+		}
+	}
+	return kept, disabled, nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/migrate"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"gorm.io/gorm"
+)
+
+type testModule struct {
+	name string
+	deps []string
+}
+
+func (m *testModule) Name() string                                             { return m.name }
+func (m *testModule) Initialize(*gorm.DB, *logger.Logger, *bus.EventBus) error { return nil }
+func (m *testModule) RegisterRoutes(*echo.Echo, string)                        {}
+func (m *testModule) Migrations() []migrate.Migration                          { return nil }
+func (m *testModule) Logger() *logger.Logger                                   { return nil }
+func (m *testModule) Dependencies() []string                                   { return m.deps }
+
+func names(modules []Module) string {
+	result := make([]string, len(modules))
+	for i, module := range modules {
+		result[i] = module.Name()
+	}
+	return strings.Join(result, ",")
+}
+
+func TestSortModules(t *testing.T) {
+	modules := []Module{
+		&testModule{name: "auth", deps: []string{"user"}},
+		&testModule{name: "billing", deps: []string{"auth", "user"}},
+		&testModule{name: "user"},
+		&testModule{name: "anime"},
+	}
+
+	sorted, err := sortModules(modules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := names(sorted), "user,auth,billing,anime"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestSortModulesMissingDependency(t *testing.T) {
+	_, err := sortModules([]Module{&testModule{name: "auth", deps: []string{"user"}}})
+	if err == nil || !strings.Contains(err.Error(), "unregistered module user") {
+		t.Fatalf("expected missing dependency error, got %v", err)
+	}
+}
+
+func TestSortModulesCycle(t *testing.T) {
+	_, err := sortModules([]Module{
+		&testModule{name: "a", deps: []string{"b"}},
+		&testModule{name: "b", deps: []string{"c"}},
+		&testModule{name: "c", deps: []string{"a"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestSortModulesDuplicate(t *testing.T) {
+	_, err := sortModules([]Module{&testModule{name: "user"}, &testModule{name: "user"}})
+	if err == nil {
+		t.Fatal("expected duplicate module error")
+	}
+}
+
+func TestEnabledModules(t *testing.T) {
+	modules := []Module{
+		&testModule{name: "user"},
+		&testModule{name: "auth", deps: []string{"user"}},
+		&testModule{name: "events"},
+	}
+
+	kept, disabled, err := enabledModules(modules, func(name string) bool { return name != "events" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(kept) != "user,auth" || strings.Join(disabled, ",") != "events" {
+		t.Errorf("Expected events to be disabled, got %s and %v", names(kept), disabled)
+	}
+
+	_, _, err = enabledModules(modules, func(name string) bool { return name != "user" })
+	if err == nil || !strings.Contains(err.Error(), "auth depends on disabled module user") {
+		t.Errorf("Expected a dependency on a disabled module to fail, got %v", err)
+	}
+}
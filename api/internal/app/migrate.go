@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"nanonime/internal/pkg/migrate"
+)
+
+// Migrate runs the migrate command with args, one of
+//
+//	up                              apply every pending migration
+//	down [-steps n] [-module name]  revert the last applied migrations
+//	status                          list the migrations and when they were applied
+//
+// It only opens the database, the modules are configured but not
+// initialized.
+func (a *App) Migrate(args []string, out io.Writer) (err error) {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up | down [-steps n] [-module name] | status")
+	}
+
+	if err := a.prepareModules(); err != nil {
+		return err
+	}
+
+	db, dbErr := a.SetDatabase().OpenDB()
+	if dbErr != nil {
+		return *dbErr
+	}
+	a.db = db
+	defer func() {
+		if sqlDB, dbErr := a.db.DB(); dbErr == nil {
+			err = errors.Join(err, sqlDB.Close())
+		}
+	}()
+
+	migrator, err := a.SetMigrator()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		fmt.Fprintf(out, "%d migration(s) applied\n", applied)
+		return err
+
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		flags.SetOutput(out)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		module := flags.String("module", "", "only revert migrations of this module")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return fmt.Errorf("-steps must be at least 1, got %d", *steps)
+		}
+		reverted, err := migrator.Down(ctx, *module, *steps)
+		fmt.Fprintf(out, "%d migration(s) reverted\n", reverted)
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		writeStatus(out, statuses)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
+
+func writeStatus(out io.Writer, statuses []migrate.Status) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tVERSION\tNAME\tAPPLIED")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Local().Format(time.RFC3339)
+		}
+		if status.Missing {
+			applied += " (missing)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", status.Module, status.Version, status.Name, applied)
+	}
+	w.Flush()
+}
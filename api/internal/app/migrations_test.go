@@ -0,0 +1,167 @@
+package app_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/migrate"
+	"nanonime/modules/auth"
+	"nanonime/modules/cache"
+	"nanonime/modules/events"
+	user "nanonime/modules/users"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// migrations returns the migrations of the outbox and of every module in the
+// order the application applies them
+func migrations() map[string][]migrate.Migration {
+	return map[string][]migrate.Migration{
+		"bus":    bus.OutboxMigrations(),
+		"user":   user.NewModule().Migrations(),
+		"auth":   auth.NewModule().Migrations(),
+		"events": events.NewModule().Migrations(),
+		"cache":  cache.NewModule().Migrations(),
+	}
+}
+
+func newMigrator(t *testing.T, db *gorm.DB) *migrate.Migrator {
+	t.Helper()
+
+	migrator := migrate.New(db, nil, migrate.Options{})
+	all := migrations()
+	for _, module := range []string{"bus", "user", "auth", "events", "cache"} {
+		if err := migrator.Register(module, all[module]...); err != nil {
+			t.Fatalf("register migrations of %s: %v", module, err)
+		}
+	}
+	return migrator
+}
+
+// recorder is a connection pool keeping the statements it executes
+type recorder struct {
+	statements []string
+}
+
+func (r *recorder) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+
+func (r *recorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.statements = append(r.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (r *recorder) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("query not supported")
+}
+
+func (r *recorder) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestMigrationsUsePostgresSyntax(t *testing.T) {
+	pool := &recorder{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: pool}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+
+	for module, list := range migrations() {
+		for _, migration := range list {
+			pool.statements = nil
+			if err := migration.Up(db); err != nil {
+				t.Fatalf("%s %d_%s: %v", module, migration.Version, migration.Name, err)
+			}
+			if migration.Down != nil {
+				if err := migration.Down(db); err != nil {
+					t.Fatalf("%s %d_%s down: %v", module, migration.Version, migration.Name, err)
+				}
+			}
+			if len(pool.statements) == 0 {
+				t.Errorf("%s %d_%s executed nothing", module, migration.Version, migration.Name)
+			}
+
+			for _, statement := range pool.statements {
+				upper := strings.ToUpper(statement)
+				for _, mysqlOnly := range []string{"`", "ENUM(", "AUTO_INCREMENT", "UNSIGNED", "LONGTEXT", "DATETIME"} {
+					if strings.Contains(upper, mysqlOnly) {
+						t.Errorf("%s %d_%s runs %s on postgres:\n%s", module, migration.Version, migration.Name, mysqlOnly, statement)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMigrationsUpAndDown(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	testUpAndDown(t, db)
+
+	// Roles are constrained by the schema itself
+	err = db.Exec("INSERT INTO users (name, email, role) VALUES ('root', 'root@example.com', 'root')").Error
+	if err == nil {
+		t.Error("expected the users table to reject an unknown role")
+	}
+}
+
+// TestMigrationsOnPostgres runs the migrations on the server of
+// NANONIME_TEST_POSTGRES_DSN, e.g.
+// "host=localhost user=postgres password=postgres dbname=nanonime_test"
+func TestMigrationsOnPostgres(t *testing.T) {
+	dsn := os.Getenv("NANONIME_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("NANONIME_TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+
+	testUpAndDown(t, db)
+}
+
+// testUpAndDown applies every migration, then reverts them all and applies
+// them again
+func testUpAndDown(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	ctx := context.Background()
+
+	migrator := newMigrator(t, db)
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	for _, module := range []string{"cache", "events", "auth", "user", "bus"} {
+		if _, err := migrator.Down(ctx, module, len(migrations()[module])); err != nil {
+			t.Fatalf("migrate down %s: %v", module, err)
+		}
+	}
+	if db.Migrator().HasTable("users") || db.Migrator().HasTable("event_outbox") {
+		t.Fatal("expected the tables to be dropped")
+	}
+
+	reapplied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("migrate up again: %v", err)
+	}
+	if reapplied != applied {
+		t.Errorf("expected %d migrations to be applied again, got %d", applied, reapplied)
+	}
+}
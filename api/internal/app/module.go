@@ -1,8 +1,12 @@
 package app
 
 import (
+	"context"
 	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/cache"
+	"nanonime/internal/pkg/config"
 	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/migrate"
 
 	"github.com/labstack/echo"
 	"gorm.io/gorm"
@@ -19,9 +23,68 @@ type Module interface {
 	// RegisterRoutes registers the module's routes
 	RegisterRoutes(e *echo.Echo, group string)
 
-	// Migrations returns the module's database migrations
-	Migrations() error
+	// Migrations returns the module's versioned database migrations. They
+	// are applied after the migrations of the modules it depends on.
+	Migrations() []migrate.Migration
 
 	// Logger returns the module's logger
 	Logger() *logger.Logger
 }
+
+// DependentModule is implemented by modules that require other modules to be
+// initialized before them
+type DependentModule interface {
+	Module
+
+	// Dependencies returns the names of the modules this module depends on
+	Dependencies() []string
+}
+
+// StoppableModule is implemented by modules that hold resources which must be
+// released when the application shuts down
+type StoppableModule interface {
+	Module
+
+	// Stop releases the module's resources before the deadline in ctx
+	Stop(ctx context.Context) error
+}
+
+// ConfigurableModule is implemented by modules reading the application
+// configuration. Configure is called for every enabled module before any of
+// them is initialized, modules decode their own [modules.<name>] section with
+// cfg.Module.
+type ConfigurableModule interface {
+	Module
+
+	// Configure hands the module the loaded configuration
+	Configure(cfg *config.Config) error
+}
+
+// ReloadableModule is implemented by modules applying configuration changes
+// while running. Reload is called after each reload with the configuration
+// in effect, before config.Reloaded is published.
+type ReloadableModule interface {
+	Module
+
+	// Reload applies the settings of cfg, changed lists the changed keys
+	Reload(cfg *config.Config, changed []string)
+}
+
+// CacheModule is implemented by modules that cache data. UseCache is called
+// with the application's cache store before Initialize.
+type CacheModule interface {
+	Module
+
+	// UseCache hands the module the shared cache store
+	UseCache(store cache.Store)
+}
+
+// CacheInvalidatingModule is implemented by modules whose events make cached
+// data stale. DeclareInvalidations is called after Initialize.
+type CacheInvalidatingModule interface {
+	Module
+
+	// DeclareInvalidations maps the module's events to the cache tags or
+	// keys they invalidate
+	DeclareInvalidations(invalidator *cache.Invalidator)
+}
@@ -0,0 +1,136 @@
+// Package users is the contract of the user module: the requests it answers
+// on the bus and the events it publishes. Other modules import this package
+// instead of the module's own, so they only see the fields they need and
+// never a password hash. Send the requests with bus.Request.
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+// Roles
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Errors answered by the requests
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrInvalidPassword = errors.New("invalid password")
+)
+
+// Account is the reply of every request, a user without its credentials
+type Account struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// FindUserByEmail answers the *Account with Email
+type FindUserByEmail struct {
+	Email string
+}
+
+// EventName returns the request name
+func (FindUserByEmail) EventName() string {
+	return "user.find_by_email"
+}
+
+// FindUserByID answers the *Account with ID
+type FindUserByID struct {
+	ID uint
+}
+
+// EventName returns the request name
+func (FindUserByID) EventName() string {
+	return "user.find_by_id"
+}
+
+// CreateUser stores a new user and publishes UserCreated. It answers the
+// created *Account.
+type CreateUser struct {
+	Name         string
+	Email        string
+	PasswordHash string
+}
+
+// EventName returns the request name
+func (CreateUser) EventName() string {
+	return "user.create"
+}
+
+// CheckPassword answers the *Account of the user with ID, or Email when ID
+// is zero, if Password matches theirs and ErrInvalidPassword otherwise
+type CheckPassword struct {
+	ID       uint
+	Email    string
+	Password string
+}
+
+// EventName returns the request name
+func (CheckPassword) EventName() string {
+	return "user.check_password"
+}
+
+// SetPassword replaces the password of the user with ID, the password must
+// already be hashed. It answers the saved *Account.
+type SetPassword struct {
+	ID           uint
+	PasswordHash string
+}
+
+// EventName returns the request name
+func (SetPassword) EventName() string {
+	return "user.set_password"
+}
+
+// VerifyEmail marks the email address of the user with ID as verified. It
+// answers the saved *Account.
+type VerifyEmail struct {
+	ID uint
+}
+
+// EventName returns the request name
+func (VerifyEmail) EventName() string {
+	return "user.verify_email"
+}
+
+// UserCreated is published as "user.created" after an account is created
+type UserCreated struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// UserUpdated is published as "user.updated" after an account's profile,
+// role or credentials change
+type UserUpdated struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// UserRoleChanged is published as "user.role_changed" after an admin changes
+// an account's role, together with UserUpdated. Access tokens carrying the
+// previous role must stop being accepted.
+type UserRoleChanged struct {
+	ID   uint   `json:"id"`
+	Role string `json:"role"`
+}
+
+// UserDeleted is published as "user.deleted" after an account is deleted
+type UserDeleted struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
+}
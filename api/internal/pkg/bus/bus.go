@@ -1,11 +1,62 @@
 package bus
 
-import "sync"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/trace"
+
+	"gorm.io/gorm"
+)
 
 // Event represents an event in our system
 type Event struct {
 	Type    string
 	Payload interface{}
+	// Headers carry metadata such as the trace context, they travel with
+	// the event through the outbox and remote transports
+	Headers Headers
+
+	// ctx is the context handed to the handler, cancelled at its timeout
+	ctx context.Context
+}
+
+// Headers are the metadata of an event
+type Headers map[string]string
+
+// Context returns a context carrying the trace the event was published in.
+// Within a handler with a timeout it is cancelled when the timeout expires.
+func (e Event) Context() context.Context {
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if sc, err := trace.Parse(e.Headers[trace.Header]); err == nil {
+		ctx = trace.NewContext(ctx, sc)
+	}
+	return ctx
+}
+
+// withTrace returns a copy of the event carrying a child span of the trace
+// in ctx
+func (e Event) withTrace(ctx context.Context) Event {
+	sc, ok := trace.FromContext(ctx)
+	if !ok {
+		return e
+	}
+
+	headers := make(Headers, len(e.Headers)+1)
+	for k, v := range e.Headers {
+		headers[k] = v
+	}
+	headers[trace.Header] = sc.Child().Traceparent()
+	e.Headers = headers
+	return e
 }
 
 // EventHandler is an interface for event handlers
@@ -21,69 +72,375 @@ func (f EventHandlerFunc) Handle(event Event) {
 	f(event)
 }
 
-// EventBus manages the event distribution
+// ErrorHandler is implemented by handlers that can report failure. With the
+// outbox enabled a failed delivery is retried, so such handlers must be
+// idempotent.
+type ErrorHandler interface {
+	EventHandler
+	HandleEvent(event Event) error
+}
+
+// ErrorHandlerFunc is a function type that implements ErrorHandler
+type ErrorHandlerFunc func(event Event) error
+
+// Handle calls the function and drops its error
+func (f ErrorHandlerFunc) Handle(event Event) {
+	f(event)
+}
+
+// HandleEvent calls the function itself
+func (f ErrorHandlerFunc) HandleEvent(event Event) error {
+	return f(event)
+}
+
+// Config holds the event bus configuration
+type Config struct {
+	// QueueSize is the buffer of the publish channel
+	QueueSize int `json:"queue_size"`
+	// Workers is the default number of goroutines handling events for
+	// each subscription
+	Workers int `json:"workers"`
+	// HandlerTimeout is the default time a handler may run before its
+	// context is cancelled and the worker moves on, zero disables it
+	HandlerTimeout time.Duration `json:"handler_timeout"`
+	// RequestTimeout bounds requests whose context has no deadline, zero
+	// disables it
+	RequestTimeout time.Duration `json:"request_timeout"`
+	// Transport carries events between bus instances, nil keeps them in
+	// this process
+	Transport Transport `json:"-"`
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() Config {
+	return Config{
+		QueueSize:      100,
+		Workers:        1,
+		HandlerTimeout: 30 * time.Second,
+		RequestTimeout: 5 * time.Second,
+	}
+}
+
+// EventBus manages the event distribution. Every subscription has its own
+// queue and workers, so a slow or failing handler only delays itself. Events
+// travel through a Transport, by default an in-memory channel.
 type EventBus struct {
-	eventChannel chan Event
-	handlers     map[string][]EventHandler
-	mu           sync.RWMutex
-	wg           sync.WaitGroup
+	transport Transport
+	// remote is set for transports connecting several processes
+	remote bool
+	// subscriptions holds exact event types, patterns the subscriptions
+	// with wildcards
+	subscriptions map[string][]*Subscription
+	patterns      []*Subscription
+	requests      map[string]RequestHandler
+	mu            sync.RWMutex
+	wg            sync.WaitGroup
+
+	// closeMu guards closed so Publish never uses a closed transport
+	closeMu sync.RWMutex
+	closed  bool
+
+	cfg    Config
+	logger *logger.Logger
+
+	outbox   *Outbox
+	payloads payloadTypes
+	metrics  metrics
 }
 
-// NewEventBus creates a new event bus
+// NewEventBus creates a new event bus with the default configuration
 func NewEventBus() *EventBus {
+	return NewEventBusWithConfig(DefaultConfig(), nil)
+}
+
+// NewEventBusWithConfig creates a new event bus. log receives handler
+// failures of subscriptions without their own logger and may be nil.
+func NewEventBusWithConfig(cfg Config, log *logger.Logger) *EventBus {
+	defaults := DefaultConfig()
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+
 	bus := &EventBus{
-		eventChannel: make(chan Event, 100), // Buffer size of 100 events
-		handlers:     make(map[string][]EventHandler),
+		transport:     cfg.Transport,
+		remote:        cfg.Transport != nil,
+		subscriptions: make(map[string][]*Subscription),
+		cfg:           cfg,
+		logger:        log,
+	}
+	bus.metrics.startedAt = time.Now()
+	if bus.transport == nil {
+		bus.transport = newMemoryTransport(cfg.QueueSize, &bus.wg, bus.dispatch)
 	}
-	go bus.processEvents()
 	return bus
 }
 
-// Subscribe registers a handler for a specific event type
-func (bus *EventBus) Subscribe(eventType string, handler EventHandler) {
+// Subscribe registers a handler for an event type or a pattern of dot
+// separated segments, where "*" matches exactly one segment and a trailing
+// ">" one or more segments: "user.*" matches "user.created" and "user.>"
+// also matches "user.profile.updated". It panics on a malformed pattern.
+func (bus *EventBus) Subscribe(eventType string, handler EventHandler, opts ...SubscribeOption) *Subscription {
+	p, err := parsePattern(eventType)
+	if err != nil {
+		panic(err)
+	}
+	sub := newSubscription(bus, p, handler, opts...)
+
+	if bus.remote {
+		cancel, err := bus.transport.Subscribe(eventType, sub.group, bus.receiver(sub))
+		if err != nil {
+			sub.logError("Failed to subscribe on transport", "pattern", eventType, "handler", sub.name, "error", err)
+		}
+		sub.cancel = cancel
+	}
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if p.exact {
+		bus.subscriptions[eventType] = append(bus.subscriptions[eventType], sub)
+	} else {
+		bus.patterns = append(bus.patterns, sub)
+	}
+	return sub
+}
+
+// receiver returns the callback a remote transport delivers the events of
+// sub to. Payloads arrive as JSON and are decoded into the registered type.
+func (bus *EventBus) receiver(sub *Subscription) func(Event) {
+	return func(event Event) {
+		if raw, ok := event.Payload.(json.RawMessage); ok {
+			decoded, err := bus.decode(event.Type, raw)
+			if err != nil {
+				sub.logError("Failed to decode event", "event", event.Type, "handler", sub.name, "error", err)
+				return
+			}
+			decoded.Headers = event.Headers
+			event = decoded
+		}
+		sub.enqueue(event, nil)
+	}
+}
+
+// SubscribeFunc registers a function as a handler for an event type or
+// pattern, see Subscribe
+func (bus *EventBus) SubscribeFunc(eventType string, handlerFunc func(event Event), opts ...SubscribeOption) *Subscription {
+	return bus.Subscribe(eventType, EventHandlerFunc(handlerFunc), opts...)
+}
+
+// SubscribeAll registers a handler for every event, for cross-cutting
+// consumers such as audit logging
+func (bus *EventBus) SubscribeAll(handler EventHandler, opts ...SubscribeOption) *Subscription {
+	return bus.Subscribe(">", handler, opts...)
+}
+
+// remove unregisters a subscription
+func (bus *EventBus) remove(sub *Subscription) {
 	bus.mu.Lock()
 	defer bus.mu.Unlock()
-	bus.handlers[eventType] = append(bus.handlers[eventType], handler)
+
+	if sub.pattern.exact {
+		bus.subscriptions[sub.pattern.raw] = without(bus.subscriptions[sub.pattern.raw], sub)
+		if len(bus.subscriptions[sub.pattern.raw]) == 0 {
+			delete(bus.subscriptions, sub.pattern.raw)
+		}
+		return
+	}
+	bus.patterns = without(bus.patterns, sub)
+}
+
+// without returns a copy of subs without sub, so slices handed out by
+// matching stay untouched
+func without(subs []*Subscription, sub *Subscription) []*Subscription {
+	result := make([]*Subscription, 0, len(subs))
+	for _, s := range subs {
+		if s != sub {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// matching returns the subscriptions of an event type
+func (bus *EventBus) matching(eventType string) []*Subscription {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+
+	exact := bus.subscriptions[eventType]
+	if len(bus.patterns) == 0 {
+		return exact
+	}
+
+	subs := append([]*Subscription(nil), exact...)
+	for _, sub := range bus.patterns {
+		if sub.pattern.match(eventType) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// UseOutbox makes Publish persist events in the outbox instead of queueing
+// them in memory. It must be called before events are published.
+func (bus *EventBus) UseOutbox(outbox *Outbox) {
+	bus.outbox = outbox
 }
 
-// SubscribeFunc registers a function as a handler for a specific event type
-func (bus *EventBus) SubscribeFunc(eventType string, handlerFunc func(event Event)) {
-	bus.Subscribe(eventType, EventHandlerFunc(handlerFunc))
+// Outbox returns the outbox of a persistent bus, nil for an in-memory bus
+func (bus *EventBus) Outbox() *Outbox {
+	return bus.outbox
 }
 
-// Publish sends an event to the event bus
+// Publish sends an event to the event bus. Events published after Close are
+// dropped. With an outbox the event is persisted first, and only handed to the
+// transport directly if writing it fails.
 func (bus *EventBus) Publish(event Event) {
-	bus.wg.Add(1)
-	bus.eventChannel <- event
-}
-
-// processEvents processes events from the event channel
-func (bus *EventBus) processEvents() {
-	for event := range bus.eventChannel {
-		bus.mu.RLock()
-		handlers, exists := bus.handlers[event.Type]
-		bus.mu.RUnlock()
-
-		if exists {
-			for _, handler := range handlers {
-				// Create a closure to ensure we use the correct handler and event
-				func(handler EventHandler, event Event) {
-					defer bus.wg.Done()
-					handler.Handle(event)
-				}(handler, event)
-			}
-		} else {
-			bus.wg.Done()
+	bus.closeMu.RLock()
+	defer bus.closeMu.RUnlock()
+
+	if bus.closed {
+		return
+	}
+	bus.metrics.published(event.Type)
+
+	if bus.outbox != nil {
+		err := bus.outbox.Enqueue(bus.outbox.db, event)
+		if err == nil {
+			return
+		}
+		bus.outbox.logError("Failed to write event to outbox, publishing directly", "event", event.Type, "error", err)
+	}
+
+	if err := bus.transport.Publish(event); err != nil {
+		bus.logError("Failed to publish event", "event", event.Type, "error", err)
+	}
+}
+
+// PublishContext publishes the event as part of the trace in ctx, see
+// Event.Context
+func (bus *EventBus) PublishContext(ctx context.Context, event Event) {
+	bus.Publish(event.withTrace(ctx))
+}
+
+// PublishLocal hands the event to the subscriptions of this process only,
+// skipping the outbox and remote transports. It is meant for events about the
+// process itself, such as a reload of its configuration, which must neither
+// outlive it nor reach other instances.
+func (bus *EventBus) PublishLocal(event Event) {
+	bus.closeMu.RLock()
+	defer bus.closeMu.RUnlock()
+
+	if bus.closed {
+		return
+	}
+	bus.metrics.published(event.Type)
+	bus.dispatch(event)
+}
+
+// PublishTx writes the event to the outbox within tx, so it is delivered only
+// if tx commits. Without an outbox the event is published right away.
+func (bus *EventBus) PublishTx(tx *gorm.DB, event Event) error {
+	event = event.withTrace(tx.Statement.Context)
+	if bus.outbox == nil {
+		bus.Publish(event)
+		return nil
+	}
+	bus.metrics.published(event.Type)
+	return bus.outbox.Enqueue(tx, event)
+}
+
+// forward is used by the outbox relay. A remote transport takes over the
+// event, so only publishing is retried; otherwise the event is delivered to
+// the local subscriptions and failing handlers are retried.
+func (bus *EventBus) forward(event Event) error {
+	if !bus.remote {
+		return bus.deliver(event)
+	}
+
+	bus.closeMu.RLock()
+	defer bus.closeMu.RUnlock()
+	if bus.closed {
+		return ErrClosed
+	}
+	return bus.transport.Publish(event)
+}
+
+// deliver hands the event to every subscription and waits for the handlers.
+// It returns the failures of the handlers, including panics and timeouts.
+func (bus *EventBus) deliver(event Event) error {
+	bus.closeMu.RLock()
+	if bus.closed {
+		bus.closeMu.RUnlock()
+		return ErrClosed
+	}
+
+	subscriptions := bus.matching(event.Type)
+	results := make(chan error, len(subscriptions))
+	pending := 0
+	for _, sub := range subscriptions {
+		if sub.enqueue(event, results) {
+			pending++
+		}
+	}
+	bus.closeMu.RUnlock()
+
+	var errs []error
+	for i := 0; i < pending; i++ {
+		if err := <-results; err != nil {
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// dispatch fans an event of the in-memory transport out to the queues of its
+// subscriptions
+func (bus *EventBus) dispatch(event Event) {
+	for _, sub := range bus.matching(event.Type) {
+		sub.enqueue(event, nil)
+	}
+}
+
+func (bus *EventBus) logError(msg string, fields ...interface{}) {
+	if bus.logger != nil {
+		bus.logger.Error(msg, fields...)
+		return
+	}
+	log.Println(append([]interface{}{msg}, fields...)...)
 }
 
-// Wait waits for all published events to be processed
+// Wait waits for all published events to be processed. With a remote
+// transport it only covers the events this process has received.
 func (bus *EventBus) Wait() {
 	bus.wg.Wait()
 }
 
-// Close shuts down the event bus
+// Close stops accepting new events and returns once the events already queued
+// have been handled. Calling Close more than once is a no-op.
 func (bus *EventBus) Close() {
-	close(bus.eventChannel)
+	bus.closeMu.Lock()
+	if bus.closed {
+		bus.closeMu.Unlock()
+		return
+	}
+	bus.closed = true
+	bus.closeMu.Unlock()
+
+	if err := bus.transport.Close(); err != nil {
+		bus.logError("Failed to close event transport", "error", err)
+	}
+
+	// handlers may unsubscribe while draining, so close outside the lock
+	bus.mu.RLock()
+	all := append([]*Subscription(nil), bus.patterns...)
+	for _, subscriptions := range bus.subscriptions {
+		all = append(all, subscriptions...)
+	}
+	bus.mu.RUnlock()
+
+	for _, sub := range all {
+		sub.close()
+	}
 }
@@ -1,6 +1,11 @@
 package bus
 
-import "testing"
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 type testHandler struct {
 	called bool
@@ -27,3 +32,160 @@ func TestEventBus(t *testing.T) {
 
 	t.Log("EventBus test passed")
 }
+
+func TestEventBusMultipleHandlersAndClose(t *testing.T) {
+	bus := NewEventBus()
+
+	first, second := &testHandler{}, &testHandler{}
+	bus.Subscribe("test", first)
+	bus.Subscribe("test", second)
+
+	bus.Publish(Event{Type: "test"})
+	bus.Publish(Event{Type: "unhandled"})
+	bus.Wait()
+
+	if !first.called || !second.called {
+		t.Errorf("Expected every handler to be called")
+	}
+
+	bus.Close()
+	bus.Close()
+
+	// Publishing after Close must not panic
+	bus.Publish(Event{Type: "test"})
+}
+
+func TestEventBusIsolatesHandlers(t *testing.T) {
+	bus := NewEventBusWithConfig(Config{HandlerTimeout: 50 * time.Millisecond}, nil)
+	defer bus.Close()
+
+	// A blocked handler must not delay other subscriptions or event types
+	var finished atomic.Bool
+	bus.SubscribeFunc("slow", func(event Event) {
+		<-event.Context().Done()
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+	})
+	bus.SubscribeFunc("slow", func(event Event) { panic("boom") })
+
+	var handled atomic.Int32
+	bus.SubscribeFunc("fast", func(event Event) { handled.Add(1) }, WithWorkers(4))
+
+	bus.Publish(Event{Type: "slow"})
+	for i := 0; i < 10; i++ {
+		bus.Publish(Event{Type: "fast"})
+	}
+
+	deadline := time.After(time.Second)
+	for handled.Load() != 10 {
+		select {
+		case <-deadline:
+			t.Fatalf("fast handler only handled %d events", handled.Load())
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	// The timeout cancels the handler's context, Wait returns once the
+	// handler actually returned
+	waited := make(chan struct{})
+	go func() {
+		bus.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		if !finished.Load() {
+			t.Fatal("Wait returned while a timed out handler was running")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked on a cancelled handler")
+	}
+}
+
+func TestEventBusPatternsAndUnsubscribe(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var mu sync.Mutex
+	received := map[string][]string{}
+	record := func(name string) func(Event) {
+		return func(event Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name] = append(received[name], event.Type)
+		}
+	}
+
+	bus.SubscribeFunc("user.*", record("segment"))
+	bus.SubscribeFunc("user.>", record("tail"))
+	all := bus.SubscribeAll(EventHandlerFunc(record("all")))
+	exact := bus.SubscribeFunc("user.created", record("exact"))
+
+	bus.Publish(Event{Type: "user.created"})
+	bus.Publish(Event{Type: "user.profile.updated"})
+	bus.Publish(Event{Type: "auth.lockout"})
+	bus.Wait()
+
+	exact.Unsubscribe()
+	all.Unsubscribe()
+	all.Unsubscribe()
+	bus.Publish(Event{Type: "user.created"})
+	bus.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string]int{"segment": 2, "tail": 3, "all": 3, "exact": 1}
+	for name, want := range expected {
+		if got := len(received[name]); got != want {
+			t.Errorf("%s subscription received %d events (%v), want %d", name, got, received[name], want)
+		}
+	}
+}
+
+func TestPatternValidation(t *testing.T) {
+	for _, raw := range []string{"", "user.", "user.>.created", "user.cre*"} {
+		if _, err := parsePattern(raw); err == nil {
+			t.Errorf("Expected pattern %q to be rejected", raw)
+		}
+	}
+
+	p, _ := parsePattern("*.created")
+	if !p.match("user.created") || p.match("user.profile.created") || p.match("created") {
+		t.Errorf("Unexpected matches for %q", p.raw)
+	}
+}
+
+func TestDeliverWaitsForTimedOutHandler(t *testing.T) {
+	bus := NewEventBusWithConfig(Config{HandlerTimeout: 20 * time.Millisecond}, nil)
+	defer bus.Close()
+
+	// A handler ignoring its context keeps running after the timeout
+	var finished atomic.Bool
+	bus.SubscribeFunc("stuck", func(event Event) {
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+	})
+
+	if err := bus.deliver(Event{Type: "stuck"}); err == nil {
+		t.Fatal("Expected the timeout to be reported")
+	}
+	if !finished.Load() {
+		t.Error("Expected the outcome only once the handler returned, so a retry cannot overlap it")
+	}
+}
+
+func TestUnsubscribeConcurrently(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	sub := bus.SubscribeFunc("test", func(Event) {})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub.Unsubscribe()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,274 @@
+package bus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the handler latency
+// histogram
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type handlerKey struct {
+	eventType string
+	handler   string
+}
+
+type handlerMetrics struct {
+	outcomes map[string]uint64
+	// buckets counts observations per bucket, the last one is +Inf
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// metrics counts published events and handler results since start
+type metrics struct {
+	mu        sync.Mutex
+	events    map[string]uint64
+	handlers  map[handlerKey]*handlerMetrics
+	startedAt time.Time
+}
+
+func (m *metrics) published(eventType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.events == nil {
+		m.events = make(map[string]uint64)
+	}
+	m.events[eventType]++
+}
+
+func (m *metrics) handled(eventType, handler, outcome string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.handlers == nil {
+		m.handlers = make(map[handlerKey]*handlerMetrics)
+	}
+	key := handlerKey{eventType, handler}
+	h, ok := m.handlers[key]
+	if !ok {
+		h = &handlerMetrics{
+			outcomes: make(map[string]uint64),
+			buckets:  make([]uint64, len(latencyBuckets)+1),
+		}
+		m.handlers[key] = h
+	}
+
+	seconds := latency.Seconds()
+	h.outcomes[outcome]++
+	h.buckets[sort.SearchFloat64s(latencyBuckets, seconds)]++
+	h.count++
+	h.sum += seconds
+}
+
+// EventMetrics counts the events of a type published by this process
+type EventMetrics struct {
+	Type      string `json:"type"`
+	Published uint64 `json:"published"`
+}
+
+// Bucket is a cumulative histogram bucket
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// HandlerMetrics describes how a handler dealt with the events of a type
+type HandlerMetrics struct {
+	EventType string            `json:"event_type"`
+	Handler   string            `json:"handler"`
+	Outcomes  map[string]uint64 `json:"outcomes"`
+	// Buckets, Count and Sum describe the latency in seconds
+	Buckets []Bucket `json:"buckets"`
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+}
+
+// SubscriptionInfo describes a registered subscription
+type SubscriptionInfo struct {
+	Pattern  string        `json:"pattern"`
+	Handler  string        `json:"handler"`
+	Group    string        `json:"group,omitempty"`
+	Workers  int           `json:"workers"`
+	Timeout  time.Duration `json:"timeout"`
+	Queued   int           `json:"queued"`
+	InFlight int64         `json:"in_flight"`
+}
+
+// Snapshot is the state of the bus at one point in time
+type Snapshot struct {
+	StartedAt     time.Time          `json:"started_at"`
+	Events        []EventMetrics     `json:"events"`
+	Handlers      []HandlerMetrics   `json:"handlers"`
+	Subscriptions []SubscriptionInfo `json:"subscriptions"`
+	Requests      []string           `json:"requests"`
+	// TransportQueued is the number of events waiting in the in-memory
+	// transport, -1 for remote transports
+	TransportQueued int `json:"transport_queued"`
+}
+
+// Subscriptions returns the registered subscriptions, sorted by pattern
+func (bus *EventBus) Subscriptions() []SubscriptionInfo {
+	bus.mu.RLock()
+	all := append([]*Subscription(nil), bus.patterns...)
+	for _, subscriptions := range bus.subscriptions {
+		all = append(all, subscriptions...)
+	}
+	bus.mu.RUnlock()
+
+	infos := make([]SubscriptionInfo, 0, len(all))
+	for _, sub := range all {
+		sub.mu.Lock()
+		queued := len(sub.queue)
+		sub.mu.Unlock()
+
+		infos = append(infos, SubscriptionInfo{
+			Pattern:  sub.pattern.raw,
+			Handler:  sub.name,
+			Group:    sub.group,
+			Workers:  sub.workers,
+			Timeout:  sub.timeout,
+			Queued:   queued,
+			InFlight: sub.inFlight.Load(),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Pattern != infos[j].Pattern {
+			return infos[i].Pattern < infos[j].Pattern
+		}
+		return infos[i].Handler < infos[j].Handler
+	})
+	return infos
+}
+
+// Requests returns the names of the registered request handlers
+func (bus *EventBus) Requests() []string {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+
+	names := make([]string, 0, len(bus.requests))
+	for name := range bus.requests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snapshot returns the metrics and registrations of the bus
+func (bus *EventBus) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		StartedAt:       bus.metrics.startedAt,
+		Subscriptions:   bus.Subscriptions(),
+		Requests:        bus.Requests(),
+		TransportQueued: -1,
+	}
+	if t, ok := bus.transport.(*memoryTransport); ok {
+		snapshot.TransportQueued = len(t.events)
+	}
+
+	bus.metrics.mu.Lock()
+	defer bus.metrics.mu.Unlock()
+
+	for eventType, published := range bus.metrics.events {
+		snapshot.Events = append(snapshot.Events, EventMetrics{Type: eventType, Published: published})
+	}
+	sort.Slice(snapshot.Events, func(i, j int) bool {
+		return snapshot.Events[i].Type < snapshot.Events[j].Type
+	})
+
+	for key, h := range bus.metrics.handlers {
+		hm := HandlerMetrics{
+			EventType: key.eventType,
+			Handler:   key.handler,
+			Outcomes:  make(map[string]uint64, len(h.outcomes)),
+			Count:     h.count,
+			Sum:       h.sum,
+		}
+		for outcome, n := range h.outcomes {
+			hm.Outcomes[outcome] = n
+		}
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.buckets[i]
+			hm.Buckets = append(hm.Buckets, Bucket{UpperBound: bound, Count: cumulative})
+		}
+		snapshot.Handlers = append(snapshot.Handlers, hm)
+	}
+	sort.Slice(snapshot.Handlers, func(i, j int) bool {
+		a, b := snapshot.Handlers[i], snapshot.Handlers[j]
+		if a.EventType != b.EventType {
+			return a.EventType < b.EventType
+		}
+		return a.Handler < b.Handler
+	})
+
+	return snapshot
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text format
+func (s Snapshot) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "# HELP bus_events_published_total Events published by this process.")
+	fmt.Fprintln(bw, "# TYPE bus_events_published_total counter")
+	for _, e := range s.Events {
+		fmt.Fprintf(bw, "bus_events_published_total{event=%s} %d\n", quote(e.Type), e.Published)
+	}
+
+	fmt.Fprintln(bw, "# HELP bus_handler_events_total Events handled per handler and outcome.")
+	fmt.Fprintln(bw, "# TYPE bus_handler_events_total counter")
+	for _, h := range s.Handlers {
+		outcomes := make([]string, 0, len(h.Outcomes))
+		for outcome := range h.Outcomes {
+			outcomes = append(outcomes, outcome)
+		}
+		sort.Strings(outcomes)
+		for _, outcome := range outcomes {
+			fmt.Fprintf(bw, "bus_handler_events_total{event=%s,handler=%s,outcome=%s} %d\n",
+				quote(h.EventType), quote(h.Handler), quote(outcome), h.Outcomes[outcome])
+		}
+	}
+
+	fmt.Fprintln(bw, "# HELP bus_handler_duration_seconds Time spent handling an event.")
+	fmt.Fprintln(bw, "# TYPE bus_handler_duration_seconds histogram")
+	for _, h := range s.Handlers {
+		labels := fmt.Sprintf("event=%s,handler=%s", quote(h.EventType), quote(h.Handler))
+		for _, b := range h.Buckets {
+			fmt.Fprintf(bw, "bus_handler_duration_seconds_bucket{%s,le=%s} %d\n", labels, quote(strconv.FormatFloat(b.UpperBound, 'g', -1, 64)), b.Count)
+		}
+		fmt.Fprintf(bw, "bus_handler_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.Count)
+		fmt.Fprintf(bw, "bus_handler_duration_seconds_sum{%s} %g\n", labels, h.Sum)
+		fmt.Fprintf(bw, "bus_handler_duration_seconds_count{%s} %d\n", labels, h.Count)
+	}
+
+	fmt.Fprintln(bw, "# HELP bus_subscription_queue_depth Events queued or being handled per subscription.")
+	fmt.Fprintln(bw, "# TYPE bus_subscription_queue_depth gauge")
+	for _, sub := range s.Subscriptions {
+		fmt.Fprintf(bw, "bus_subscription_queue_depth{pattern=%s,handler=%s} %d\n",
+			quote(sub.Pattern), quote(sub.Handler), int64(sub.Queued)+sub.InFlight)
+	}
+
+	if s.TransportQueued >= 0 {
+		fmt.Fprintln(bw, "# HELP bus_transport_queue_depth Events waiting to be dispatched.")
+		fmt.Fprintln(bw, "# TYPE bus_transport_queue_depth gauge")
+		fmt.Fprintf(bw, "bus_transport_queue_depth %d\n", s.TransportQueued)
+	}
+
+	return bw.Flush()
+}
+
+// quote quotes a Prometheus label value
+func quote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
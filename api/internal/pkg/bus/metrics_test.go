@@ -0,0 +1,83 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"nanonime/internal/pkg/trace"
+)
+
+func TestEventBusMetrics(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	bus.SubscribeFunc("user.created", func(Event) {}, WithName("ok"))
+	bus.Subscribe("user.*", ErrorHandlerFunc(func(Event) error {
+		return errors.New("boom")
+	}), WithName("failing"))
+
+	bus.Publish(Event{Type: "user.created"})
+	bus.Publish(Event{Type: "user.created"})
+	bus.Wait()
+
+	snapshot := bus.Snapshot()
+	if len(snapshot.Events) != 1 || snapshot.Events[0].Published != 2 {
+		t.Fatalf("Expected 2 published user.created events, got %+v", snapshot.Events)
+	}
+	if len(snapshot.Handlers) != 2 {
+		t.Fatalf("Expected metrics for 2 handlers, got %+v", snapshot.Handlers)
+	}
+	failing := snapshot.Handlers[0]
+	if failing.Handler != "failing" || failing.Outcomes[OutcomeError] != 2 || failing.Count != 2 {
+		t.Errorf("Unexpected metrics for failing handler: %+v", failing)
+	}
+	if last := failing.Buckets[len(failing.Buckets)-1]; last.Count != 2 {
+		t.Errorf("Expected cumulative buckets to end at 2, got %d", last.Count)
+	}
+
+	subscriptions := bus.Subscriptions()
+	if len(subscriptions) != 2 || subscriptions[0].Pattern != "user.*" || subscriptions[1].Handler != "ok" {
+		t.Errorf("Unexpected subscriptions: %+v", subscriptions)
+	}
+
+	var out strings.Builder
+	if err := snapshot.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`bus_events_published_total{event="user.created"} 2`,
+		`bus_handler_events_total{event="user.created",handler="failing",outcome="error"} 2`,
+		`bus_handler_duration_seconds_count{event="user.created",handler="ok"} 2`,
+		`bus_subscription_queue_depth{pattern="user.*",handler="failing"} 0`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestEventBusPropagatesTrace(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	parent := trace.New()
+	got := make(chan trace.SpanContext, 1)
+	SubscribeContext(bus, func(ctx context.Context, e UserCreated) error {
+		sc, _ := trace.FromContext(ctx)
+		got <- sc
+		return nil
+	})
+
+	PublishContext(trace.NewContext(context.Background(), parent), bus, UserCreated{})
+	bus.Wait()
+
+	sc := <-got
+	if sc.TraceID != parent.TraceID {
+		t.Errorf("Expected trace %s, got %s", parent.TraceIDString(), sc.TraceIDString())
+	}
+	if sc.SpanID == parent.SpanID {
+		t.Errorf("Expected the event to carry a child span")
+	}
+}
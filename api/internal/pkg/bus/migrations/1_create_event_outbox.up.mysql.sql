@@ -0,0 +1,26 @@
+CREATE TABLE event_outbox (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    event_type VARCHAR(191) NOT NULL,
+    payload TEXT,
+    headers TEXT,
+    attempts BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME(3) NOT NULL,
+    last_error TEXT,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_event_outbox_event_type (event_type),
+    INDEX idx_event_outbox_next_attempt_at (next_attempt_at)
+);
+
+CREATE TABLE event_dead_letters (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    event_type VARCHAR(191) NOT NULL,
+    payload TEXT,
+    headers TEXT,
+    attempts BIGINT,
+    last_error TEXT,
+    published_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_event_dead_letters_event_type (event_type)
+);
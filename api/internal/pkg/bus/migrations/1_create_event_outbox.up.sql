@@ -0,0 +1,25 @@
+-- Other drivers, e.g. sqlite in tests
+CREATE TABLE event_outbox (
+    id INTEGER PRIMARY KEY,
+    event_type VARCHAR(191) NOT NULL,
+    payload TEXT,
+    headers TEXT,
+    attempts BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error TEXT,
+    created_at DATETIME
+);
+CREATE INDEX idx_event_outbox_event_type ON event_outbox (event_type);
+CREATE INDEX idx_event_outbox_next_attempt_at ON event_outbox (next_attempt_at);
+
+CREATE TABLE event_dead_letters (
+    id INTEGER PRIMARY KEY,
+    event_type VARCHAR(191) NOT NULL,
+    payload TEXT,
+    headers TEXT,
+    attempts BIGINT,
+    last_error TEXT,
+    published_at DATETIME,
+    created_at DATETIME
+);
+CREATE INDEX idx_event_dead_letters_event_type ON event_dead_letters (event_type);
@@ -0,0 +1,162 @@
+// Package natsbus implements a bus.Transport on top of NATS, so event bus
+// instances in several processes share their events. Event types map to NATS
+// subjects and the bus' patterns use the NATS wildcards, consumer groups map
+// to NATS queue groups.
+package natsbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"nanonime/internal/pkg/bus"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Options configures the transport
+type Options struct {
+	// SubjectPrefix is prepended to event types, e.g. "nanonime." keeps the
+	// events of several applications on one server apart
+	SubjectPrefix string `json:"subject_prefix"`
+	// Name identifies the connection in the NATS monitoring
+	Name string `json:"name"`
+	// DrainTimeout bounds Close while pending messages are handed over
+	DrainTimeout time.Duration `json:"drain_timeout"`
+}
+
+// envelope is the JSON message published on NATS
+type envelope struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	Headers bus.Headers     `json:"headers,omitempty"`
+}
+
+// Transport is a bus.Transport publishing events as JSON on NATS
+type Transport struct {
+	conn   *nats.Conn
+	opts   Options
+	owned  bool
+	closed chan struct{}
+
+	mu   sync.Mutex
+	subs map[*nats.Subscription]struct{}
+}
+
+var _ bus.Transport = (*Transport)(nil)
+
+// Connect connects to the NATS server at url. The connection reconnects on
+// its own and is closed by Close.
+func Connect(url string, opts Options) (*Transport, error) {
+	closed := make(chan struct{})
+	conn, err := nats.Connect(url,
+		nats.Name(opts.Name),
+		nats.MaxReconnects(-1),
+		nats.ClosedHandler(func(*nats.Conn) { close(closed) }),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connect to nats: %w", err)
+	}
+
+	t := New(conn, opts)
+	t.owned = true
+	t.closed = closed
+	return t, nil
+}
+
+// New creates a transport on an existing connection, which Close leaves open
+func New(conn *nats.Conn, opts Options) *Transport {
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = 10 * time.Second
+	}
+	return &Transport{
+		conn: conn,
+		opts: opts,
+		subs: make(map[*nats.Subscription]struct{}),
+	}
+}
+
+// Publish implements bus.Transport
+func (t *Transport) Publish(event bus.Event) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return fmt.Errorf("encode payload of %s: %w", event.Type, err)
+	}
+	data, err := json.Marshal(envelope{Type: event.Type, Payload: payload, Headers: event.Headers})
+	if err != nil {
+		return err
+	}
+	return t.conn.Publish(t.opts.SubjectPrefix+event.Type, data)
+}
+
+// Subscribe implements bus.Transport
+func (t *Transport) Subscribe(pattern, group string, receive func(bus.Event)) (func() error, error) {
+	handler := func(msg *nats.Msg) {
+		var env envelope
+		if err := json.Unmarshal(msg.Data, &env); err != nil || env.Type == "" {
+			// not published by a bus, use the subject as event type
+			env = envelope{Type: strings.TrimPrefix(msg.Subject, t.opts.SubjectPrefix), Payload: msg.Data}
+		}
+		receive(bus.Event{Type: env.Type, Payload: env.Payload, Headers: env.Headers})
+	}
+
+	subject := t.opts.SubjectPrefix + pattern
+
+	var (
+		sub *nats.Subscription
+		err error
+	)
+	if group != "" {
+		sub, err = t.conn.QueueSubscribe(subject, group, handler)
+	} else {
+		sub, err = t.conn.Subscribe(subject, handler)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to %s: %w", subject, err)
+	}
+
+	t.mu.Lock()
+	t.subs[sub] = struct{}{}
+	t.mu.Unlock()
+
+	return func() error {
+		t.mu.Lock()
+		delete(t.subs, sub)
+		t.mu.Unlock()
+		return sub.Unsubscribe()
+	}, nil
+}
+
+// Close implements bus.Transport. Received messages are handed to the bus and
+// published ones flushed to the server first.
+func (t *Transport) Close() error {
+	if t.owned {
+		if err := t.conn.Drain(); err != nil {
+			return err
+		}
+		select {
+		case <-t.closed:
+			return nil
+		case <-time.After(t.opts.DrainTimeout):
+			t.conn.Close()
+			return fmt.Errorf("nats drain timed out after %s", t.opts.DrainTimeout)
+		}
+	}
+
+	t.mu.Lock()
+	subs := make([]*nats.Subscription, 0, len(t.subs))
+	for sub := range t.subs {
+		subs = append(subs, sub)
+	}
+	t.subs = make(map[*nats.Subscription]struct{})
+	t.mu.Unlock()
+
+	for _, sub := range subs {
+		if err := sub.Drain(); err != nil {
+			return err
+		}
+	}
+	return t.conn.FlushTimeout(t.opts.DrainTimeout)
+}
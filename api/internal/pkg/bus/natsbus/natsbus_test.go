@@ -0,0 +1,123 @@
+package natsbus
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nanonime/internal/pkg/bus"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+type UserCreated struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func runServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("start nats server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func newBus(t *testing.T, url string) (*bus.EventBus, *Transport) {
+	t.Helper()
+
+	transport, err := Connect(url, Options{SubjectPrefix: "test."})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	b := bus.NewEventBusWithConfig(bus.Config{Transport: transport}, nil)
+	t.Cleanup(b.Close)
+	return b, transport
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTransportSharesEventsBetweenBuses(t *testing.T) {
+	srv := runServer(t)
+
+	var (
+		mu      sync.Mutex
+		names   []string
+		grouped atomic.Int32
+		fanout  atomic.Int32
+	)
+
+	buses := make([]*bus.EventBus, 2)
+	for i := range buses {
+		b, transport := newBus(t, srv.ClientURL())
+		buses[i] = b
+
+		// same group in both processes, only one of them handles each event
+		bus.Subscribe(b, func(e UserCreated) {
+			grouped.Add(1)
+			mu.Lock()
+			names = append(names, e.Name)
+			mu.Unlock()
+		}, bus.WithGroup("mailer"))
+		b.SubscribeFunc("user.*", func(bus.Event) { fanout.Add(1) }, bus.WithBroadcast())
+
+		// make sure the subscriptions reached the server before publishing
+		if err := transport.conn.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		bus.Publish(buses[0], UserCreated{ID: uint(i), Name: "alice"})
+	}
+
+	waitFor(t, func() bool { return grouped.Load() == 10 && fanout.Load() == 20 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range names {
+		if name != "alice" {
+			t.Fatalf("Expected decoded payloads, got %q", name)
+		}
+	}
+}
+
+func TestUnsubscribeDetachesFromServer(t *testing.T) {
+	srv := runServer(t)
+	b, transport := newBus(t, srv.ClientURL())
+
+	var received atomic.Int32
+	sub := b.SubscribeFunc("user.deleted", func(bus.Event) { received.Add(1) })
+	transport.conn.Flush()
+
+	b.Publish(bus.Event{Type: "user.deleted", Payload: map[string]int{"id": 1}})
+	waitFor(t, func() bool { return received.Load() == 1 })
+
+	sub.Unsubscribe()
+	transport.conn.Flush()
+	b.Publish(bus.Event{Type: "user.deleted", Payload: map[string]int{"id": 2}})
+	transport.conn.Flush()
+	time.Sleep(50 * time.Millisecond)
+
+	if n := received.Load(); n != 1 {
+		t.Errorf("Expected no events after Unsubscribe, got %d", n)
+	}
+}
@@ -0,0 +1,467 @@
+package bus
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/migrate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrClosed is returned when delivering on a closed bus
+var ErrClosed = errors.New("event bus closed")
+
+// OutboxMessage is a published event waiting to be delivered by the relay
+type OutboxMessage struct {
+	ID            uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	EventType     string    `gorm:"size:191;not null;index" json:"event_type"`
+	Payload       string    `gorm:"type:text" json:"payload"`
+	Headers       Headers   `gorm:"type:text;serializer:json" json:"headers"`
+	Attempts      int       `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time `gorm:"not null;index" json:"next_attempt_at"`
+	LastError     string    `gorm:"type:text" json:"last_error"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for OutboxMessage
+func (*OutboxMessage) TableName() string {
+	return "event_outbox"
+}
+
+// DeadLetter is an event that failed delivery too many times
+type DeadLetter struct {
+	ID          uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	EventType   string    `gorm:"size:191;not null;index" json:"event_type"`
+	Payload     string    `gorm:"type:text" json:"payload"`
+	Headers     Headers   `gorm:"type:text;serializer:json" json:"headers"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `gorm:"type:text" json:"last_error"`
+	PublishedAt time.Time `json:"published_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for DeadLetter
+func (*DeadLetter) TableName() string {
+	return "event_dead_letters"
+}
+
+// OutboxConfig holds the relay configuration
+type OutboxConfig struct {
+	// PollInterval is how often the relay looks for due messages
+	PollInterval time.Duration `json:"poll_interval"`
+	// BatchSize is the number of messages claimed at once
+	BatchSize int `json:"batch_size"`
+	// MaxAttempts is the number of failed deliveries before a message is
+	// moved to the dead letters
+	MaxAttempts int `json:"max_attempts"`
+	// RetryBackoff is the delay after the first failure, doubled after
+	// every further failure up to MaxRetryBackoff
+	RetryBackoff    time.Duration `json:"retry_backoff"`
+	MaxRetryBackoff time.Duration `json:"max_retry_backoff"`
+	// ClaimTimeout hides claimed messages from other relays, it must be
+	// longer than the slowest handler
+	ClaimTimeout time.Duration `json:"claim_timeout"`
+}
+
+// DefaultOutboxConfig returns the default relay configuration
+func DefaultOutboxConfig() OutboxConfig {
+	return OutboxConfig{
+		PollInterval:    time.Second,
+		BatchSize:       50,
+		MaxAttempts:     10,
+		RetryBackoff:    5 * time.Second,
+		MaxRetryBackoff: 10 * time.Minute,
+		ClaimTimeout:    5 * time.Minute,
+	}
+}
+
+// Outbox persists events in the database and relays them to the bus in the
+// background. Delivery is at-least-once: when any handler of an event fails
+// the whole event is retried, so handlers must be idempotent.
+type Outbox struct {
+	db     *gorm.DB
+	bus    *EventBus
+	cfg    OutboxConfig
+	logger *logger.Logger
+	now    func() time.Time
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewOutbox creates an outbox relaying to bus. Call EventBus.UseOutbox to
+// route Publish through it and Start to run the relay.
+func NewOutbox(db *gorm.DB, bus *EventBus, cfg OutboxConfig) *Outbox {
+	defaults := DefaultOutboxConfig()
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaults.BatchSize
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaults.MaxAttempts
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaults.RetryBackoff
+	}
+	if cfg.MaxRetryBackoff < cfg.RetryBackoff {
+		cfg.MaxRetryBackoff = cfg.RetryBackoff
+	}
+	if cfg.ClaimTimeout <= 0 {
+		cfg.ClaimTimeout = defaults.ClaimTimeout
+	}
+
+	return &Outbox{
+		db:      db,
+		bus:     bus,
+		cfg:     cfg,
+		logger:  bus.logger,
+		now:     time.Now,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// outboxMigrations are the SQL scripts of the outbox tables, by driver
+//
+//go:embed migrations/*.sql
+var outboxMigrations embed.FS
+
+// OutboxMigrations creates the tables used by the outbox
+func OutboxMigrations() []migrate.Migration {
+	return migrate.MustFromFS(outboxMigrations, "migrations")
+}
+
+// Enqueue writes the event to the outbox using tx, which may be a
+// transaction of the business write
+func (o *Outbox) Enqueue(tx *gorm.DB, event Event) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return fmt.Errorf("encode payload of %s: %w", event.Type, err)
+	}
+
+	msg := &OutboxMessage{
+		EventType:     event.Type,
+		Payload:       string(payload),
+		Headers:       event.Headers,
+		NextAttemptAt: o.now(),
+	}
+	if err := tx.Create(msg).Error; err != nil {
+		return err
+	}
+
+	o.notify()
+	return nil
+}
+
+// notify wakes the relay up without waiting for the next poll
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the relay in the background until Stop is called
+func (o *Outbox) Start() {
+	go o.run()
+}
+
+// Stop stops the relay once the message being delivered is done or ctx
+// expires. Undelivered messages stay in the outbox for the next start.
+func (o *Outbox) Stop(ctx context.Context) error {
+	o.stopOnce.Do(func() {
+		close(o.stop)
+	})
+
+	select {
+	case <-o.stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("outbox relay still running: %w", ctx.Err())
+	}
+}
+
+func (o *Outbox) run() {
+	defer close(o.stopped)
+
+	ticker := time.NewTicker(o.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := o.RelayOnce(context.Background())
+			if err != nil {
+				o.logError("Outbox relay failed", "error", err)
+			}
+			if err != nil || n < o.cfg.BatchSize || o.stopping() {
+				break
+			}
+		}
+
+		select {
+		case <-o.stop:
+			return
+		case <-o.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Outbox) stopping() bool {
+	select {
+	case <-o.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// RelayOnce claims one batch of due messages and delivers them in order. It
+// returns the number of messages claimed.
+func (o *Outbox) RelayOnce(ctx context.Context) (int, error) {
+	messages, err := o.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range messages {
+		if o.stopping() {
+			return len(messages), o.release(ctx, messages[i:])
+		}
+		if err := o.deliver(ctx, &messages[i]); err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+// release makes claimed but undelivered messages due again
+func (o *Outbox) release(ctx context.Context, messages []OutboxMessage) error {
+	ids := make([]uint64, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return o.db.WithContext(ctx).Model(&OutboxMessage{}).
+		Where("id IN ?", ids).
+		Update("next_attempt_at", o.now()).Error
+}
+
+// claim locks a batch of due messages and pushes their next attempt past the
+// claim timeout, so concurrent relays skip them
+func (o *Outbox) claim(ctx context.Context) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	now := o.now()
+
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_attempt_at <= ?", now).
+			Order("id").
+			Limit(o.cfg.BatchSize).
+			Find(&messages).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]uint64, len(messages))
+		for i, msg := range messages {
+			ids[i] = msg.ID
+		}
+		return tx.Model(&OutboxMessage{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(o.cfg.ClaimTimeout)).Error
+	})
+	return messages, err
+}
+
+// deliver hands a message to the bus and records the outcome
+func (o *Outbox) deliver(ctx context.Context, msg *OutboxMessage) error {
+	event, err := o.bus.decode(msg.EventType, []byte(msg.Payload))
+	if err == nil {
+		event.Headers = msg.Headers
+		err = o.bus.forward(event)
+	}
+	if errors.Is(err, ErrClosed) {
+		// leave the message claimed, it is retried after the claim timeout
+		return err
+	}
+	if err == nil {
+		return o.db.WithContext(ctx).Delete(&OutboxMessage{}, msg.ID).Error
+	}
+
+	msg.Attempts++
+	msg.LastError = err.Error()
+
+	if msg.Attempts >= o.cfg.MaxAttempts {
+		o.logError("Event moved to dead letters", "event", msg.EventType, "id", msg.ID, "attempts", msg.Attempts, "error", err)
+		return o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			dead := &DeadLetter{
+				EventType:   msg.EventType,
+				Payload:     msg.Payload,
+				Headers:     msg.Headers,
+				Attempts:    msg.Attempts,
+				LastError:   msg.LastError,
+				PublishedAt: msg.CreatedAt,
+			}
+			if err := tx.Create(dead).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&OutboxMessage{}, msg.ID).Error
+		})
+	}
+
+	return o.db.WithContext(ctx).Model(&OutboxMessage{}).
+		Where("id = ?", msg.ID).
+		Updates(map[string]interface{}{
+			"attempts":        msg.Attempts,
+			"last_error":      msg.LastError,
+			"next_attempt_at": o.now().Add(o.backoff(msg.Attempts)),
+		}).Error
+}
+
+// backoff returns the delay before the next attempt after n failures
+func (o *Outbox) backoff(n int) time.Duration {
+	delay := o.cfg.RetryBackoff
+	for i := 1; i < n && delay < o.cfg.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > o.cfg.MaxRetryBackoff {
+		delay = o.cfg.MaxRetryBackoff
+	}
+	return delay
+}
+
+// DeadLetters returns dead letters, newest first
+func (o *Outbox) DeadLetters(ctx context.Context, limit, offset int) ([]DeadLetter, int64, error) {
+	var (
+		letters []DeadLetter
+		total   int64
+	)
+
+	query := o.db.WithContext(ctx).Model(&DeadLetter{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&letters).Error; err != nil {
+		return nil, 0, err
+	}
+	return letters, total, nil
+}
+
+// ErrDeadLetterNotFound is returned for unknown dead letter ids
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// Replay moves a dead letter back into the outbox with a fresh attempt count
+func (o *Outbox) Replay(ctx context.Context, id uint64) error {
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var dead DeadLetter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&dead, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDeadLetterNotFound
+			}
+			return err
+		}
+
+		msg := &OutboxMessage{
+			EventType:     dead.EventType,
+			Payload:       dead.Payload,
+			Headers:       dead.Headers,
+			NextAttemptAt: o.now(),
+		}
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&DeadLetter{}, dead.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	o.notify()
+	return nil
+}
+
+// Discard deletes a dead letter for good
+func (o *Outbox) Discard(ctx context.Context, id uint64) error {
+	result := o.db.WithContext(ctx).Delete(&DeadLetter{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func (o *Outbox) logError(msg string, fields ...interface{}) {
+	if o.logger != nil {
+		o.logger.Error(msg, fields...)
+		return
+	}
+	log.Println(append([]interface{}{msg}, fields...)...)
+}
+
+// payloadTypes maps event types to the Go type their payload is decoded into
+type payloadTypes struct {
+	mu    sync.RWMutex
+	types map[string]reflect.Type
+}
+
+// RegisterPayload declares the payload type of an event so events read back
+// from the outbox carry the same type as when published. sample is a value
+// or a pointer of that type, e.g. &entity.User{}. Payloads of unregistered
+// events are delivered as json.RawMessage.
+func (bus *EventBus) RegisterPayload(eventType string, sample interface{}) {
+	bus.registerPayloadType(eventType, reflect.TypeOf(sample))
+}
+
+func (bus *EventBus) registerPayloadType(eventType string, t reflect.Type) {
+	bus.payloads.mu.Lock()
+	defer bus.payloads.mu.Unlock()
+
+	if bus.payloads.types == nil {
+		bus.payloads.types = make(map[string]reflect.Type)
+	}
+	bus.payloads.types[eventType] = t
+}
+
+// decode rebuilds an event from its stored JSON payload
+func (bus *EventBus) decode(eventType string, data []byte) (Event, error) {
+	bus.payloads.mu.RLock()
+	t, ok := bus.payloads.types[eventType]
+	bus.payloads.mu.RUnlock()
+
+	if !ok || t == nil {
+		return Event{Type: eventType, Payload: json.RawMessage(data)}, nil
+	}
+
+	if t.Kind() == reflect.Ptr {
+		value := reflect.New(t.Elem())
+		if err := json.Unmarshal(data, value.Interface()); err != nil {
+			return Event{}, fmt.Errorf("decode payload of %s: %w", eventType, err)
+		}
+		return Event{Type: eventType, Payload: value.Interface()}, nil
+	}
+
+	value := reflect.New(t)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return Event{}, fmt.Errorf("decode payload of %s: %w", eventType, err)
+	}
+	return Event{Type: eventType, Payload: value.Elem().Interface()}, nil
+}
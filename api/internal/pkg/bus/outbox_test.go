@@ -0,0 +1,163 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"nanonime/internal/pkg/migrate"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type outboxPayload struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func newTestOutbox(t *testing.T, cfg OutboxConfig) (*EventBus, *Outbox) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	bus := NewEventBusWithConfig(Config{HandlerTimeout: 50 * time.Millisecond}, nil)
+	outbox := NewOutbox(db, bus, cfg)
+	migrator := migrate.New(db, nil, migrate.Options{})
+	if err := migrator.Register("bus", OutboxMigrations()...); err != nil {
+		t.Fatalf("register migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	bus.UseOutbox(outbox)
+
+	t.Cleanup(bus.Close)
+	return bus, outbox
+}
+
+func TestOutboxDeliversPersistedEvents(t *testing.T) {
+	bus, outbox := newTestOutbox(t, OutboxConfig{})
+	bus.RegisterPayload("test.created", &outboxPayload{})
+
+	var got *outboxPayload
+	bus.SubscribeFunc("test.created", func(event Event) {
+		got, _ = event.Payload.(*outboxPayload)
+	})
+
+	// Rolled back transactions must not leave events behind
+	outbox.db.Transaction(func(tx *gorm.DB) error {
+		if err := bus.PublishTx(tx, Event{Type: "test.created", Payload: &outboxPayload{ID: 1}}); err != nil {
+			t.Fatalf("PublishTx: %v", err)
+		}
+		return errors.New("rollback")
+	})
+	bus.Publish(Event{Type: "test.created", Payload: &outboxPayload{ID: 2, Name: "two"}})
+
+	n, err := outbox.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("Expected 1 message, got %d", n)
+	}
+	if got == nil || got.ID != 2 || got.Name != "two" {
+		t.Fatalf("Expected decoded payload, got %+v", got)
+	}
+
+	var pending int64
+	outbox.db.Model(&OutboxMessage{}).Count(&pending)
+	if pending != 0 {
+		t.Errorf("Expected delivered message to be removed, %d left", pending)
+	}
+}
+
+func TestPublishLocalSkipsOutbox(t *testing.T) {
+	bus, outbox := newTestOutbox(t, OutboxConfig{})
+
+	var got []Event
+	bus.SubscribeFunc("test.reloaded", func(event Event) {
+		got = append(got, event)
+	})
+
+	bus.PublishLocal(Event{Type: "test.reloaded", Payload: &outboxPayload{ID: 1}})
+	bus.Wait()
+	if len(got) != 1 {
+		t.Fatalf("Expected the event to be delivered in process, got %d", len(got))
+	}
+
+	var pending int64
+	outbox.db.Model(&OutboxMessage{}).Count(&pending)
+	if pending != 0 {
+		t.Errorf("Expected nothing in the outbox, found %d messages", pending)
+	}
+}
+
+func TestOutboxRetriesAndDeadLetters(t *testing.T) {
+	bus, outbox := newTestOutbox(t, OutboxConfig{MaxAttempts: 2, RetryBackoff: time.Millisecond})
+
+	now := time.Now()
+	outbox.now = func() time.Time { return now }
+
+	failing := true
+	calls := 0
+	bus.Subscribe("test.failing", ErrorHandlerFunc(func(event Event) error {
+		calls++
+		if failing {
+			return errors.New("boom")
+		}
+		return nil
+	}))
+
+	bus.Publish(Event{Type: "test.failing", Payload: "payload"})
+
+	for i := 0; i < 2; i++ {
+		if _, err := outbox.RelayOnce(context.Background()); err != nil {
+			t.Fatalf("RelayOnce: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", calls)
+	}
+
+	letters, total, err := outbox.DeadLetters(context.Background(), 10, 0)
+	if err != nil {
+		t.Fatalf("DeadLetters: %v", err)
+	}
+	if total != 1 || letters[0].Attempts != 2 || letters[0].LastError == "" {
+		t.Fatalf("Expected one dead letter after 2 attempts, got %+v", letters)
+	}
+
+	failing = false
+	if err := outbox.Replay(context.Background(), letters[0].ID); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if _, err := outbox.RelayOnce(context.Background()); err != nil {
+		t.Fatalf("RelayOnce: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected replayed event to be delivered, got %d calls", calls)
+	}
+	if err := outbox.Replay(context.Background(), letters[0].ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected ErrDeadLetterNotFound, got %v", err)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	outbox := NewOutbox(nil, NewEventBus(), OutboxConfig{RetryBackoff: time.Second, MaxRetryBackoff: 5 * time.Second})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := outbox.backoff(i + 1); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, want)
+		}
+	}
+}
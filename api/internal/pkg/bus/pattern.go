@@ -0,0 +1,63 @@
+package bus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pattern is a parsed event type or subscription pattern
+type pattern struct {
+	raw      string
+	segments []string
+	// exact is set for patterns without wildcards
+	exact bool
+}
+
+// parsePattern validates a pattern of dot separated segments where "*"
+// matches one segment and ">", only as the last segment, one or more
+func parsePattern(raw string) (pattern, error) {
+	if raw == "" {
+		return pattern{}, fmt.Errorf("bus: empty event pattern")
+	}
+
+	segments := strings.Split(raw, ".")
+	exact := true
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+			return pattern{}, fmt.Errorf("bus: empty segment in event pattern %q", raw)
+		case segment == ">":
+			if i != len(segments)-1 {
+				return pattern{}, fmt.Errorf("bus: \">\" must be the last segment of event pattern %q", raw)
+			}
+			exact = false
+		case segment == "*":
+			exact = false
+		case strings.ContainsAny(segment, "*>"):
+			return pattern{}, fmt.Errorf("bus: wildcard must be a whole segment in event pattern %q", raw)
+		}
+	}
+
+	return pattern{raw: raw, segments: segments, exact: exact}, nil
+}
+
+// match reports whether the event type matches the pattern
+func (p pattern) match(eventType string) bool {
+	if p.exact {
+		return p.raw == eventType
+	}
+
+	segments := strings.Split(eventType, ".")
+	for i, segment := range p.segments {
+		if segment == ">" {
+			return len(segments) > i
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if segment != "*" && segment != segments[i] {
+			return false
+		}
+	}
+	return len(segments) == len(p.segments)
+}
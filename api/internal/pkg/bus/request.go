@@ -0,0 +1,110 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// Request errors
+var (
+	ErrNoRequestHandler   = errors.New("no request handler registered")
+	ErrDuplicateHandler   = errors.New("request handler already registered")
+	ErrUnexpectedResponse = errors.New("unexpected response type")
+)
+
+// RequestHandler answers a named request. Returned errors are handed to the
+// caller unchanged, so they can be matched with errors.Is.
+type RequestHandler func(ctx context.Context, request interface{}) (interface{}, error)
+
+// HandleRequest registers the handler answering requests named name. Every
+// name has a single handler, usually registered by the module owning the
+// data in its Initialize.
+func (bus *EventBus) HandleRequest(name string, handler RequestHandler) error {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if bus.requests == nil {
+		bus.requests = make(map[string]RequestHandler)
+	}
+	if _, ok := bus.requests[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateHandler, name)
+	}
+	bus.requests[name] = handler
+	return nil
+}
+
+// Request calls the handler of name and waits for its response. Without a
+// deadline on ctx the bus' RequestTimeout applies. The handler runs in its
+// own goroutine, a handler that panics or outlives ctx fails the request.
+func (bus *EventBus) Request(ctx context.Context, name string, request interface{}) (interface{}, error) {
+	bus.mu.RLock()
+	handler, ok := bus.requests[name]
+	bus.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoRequestHandler, name)
+	}
+
+	if _, ok := ctx.Deadline(); !ok && bus.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, bus.cfg.RequestTimeout)
+		defer cancel()
+	}
+
+	type reply struct {
+		response interface{}
+		err      error
+	}
+	done := make(chan reply, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if bus.logger != nil {
+					bus.logger.Error("Request handler panicked", "request", name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+				}
+				done <- reply{err: fmt.Errorf("request %s: handler panicked: %v", name, r)}
+			}
+		}()
+
+		response, err := handler(ctx, request)
+		done <- reply{response: response, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.response, r.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("request %s: %w", name, ctx.Err())
+	}
+}
+
+// HandleRequestFunc registers a typed handler for requests of type Req, named
+// like events after Req (see NameOf)
+func HandleRequestFunc[Req, Res any](bus *EventBus, handler func(ctx context.Context, request Req) (Res, error)) error {
+	name := NameOf[Req]()
+	return bus.HandleRequest(name, func(ctx context.Context, request interface{}) (interface{}, error) {
+		typed, ok := request.(Req)
+		if !ok {
+			return nil, fmt.Errorf("request %s: unexpected request type %T", name, request)
+		}
+		return handler(ctx, typed)
+	})
+}
+
+// Request sends a typed request and returns the typed response
+func Request[Req, Res any](ctx context.Context, bus *EventBus, request Req) (Res, error) {
+	var zero Res
+
+	name := NameOf[Req]()
+	response, err := bus.Request(ctx, name, request)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := response.(Res)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s answered %T", ErrUnexpectedResponse, name, response)
+	}
+	return typed, nil
+}
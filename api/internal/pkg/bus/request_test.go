@@ -0,0 +1,63 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type findUser struct {
+	ID uint
+}
+
+func (findUser) EventName() string {
+	return "user.find"
+}
+
+var errNotFound = errors.New("not found")
+
+func TestRequestReply(t *testing.T) {
+	bus := NewEventBusWithConfig(Config{RequestTimeout: 50 * time.Millisecond}, nil)
+	defer bus.Close()
+
+	err := HandleRequestFunc(bus, func(ctx context.Context, q findUser) (string, error) {
+		switch q.ID {
+		case 1:
+			return "alice", nil
+		case 2:
+			<-ctx.Done()
+			return "", ctx.Err()
+		case 3:
+			panic("boom")
+		}
+		return "", errNotFound
+	})
+	if err != nil {
+		t.Fatalf("HandleRequestFunc: %v", err)
+	}
+	if err := bus.HandleRequest("user.find", nil); !errors.Is(err, ErrDuplicateHandler) {
+		t.Errorf("Expected ErrDuplicateHandler, got %v", err)
+	}
+
+	ctx := context.Background()
+	name, err := Request[findUser, string](ctx, bus, findUser{ID: 1})
+	if err != nil || name != "alice" {
+		t.Errorf("Expected alice, got %q, %v", name, err)
+	}
+	if _, err := Request[findUser, string](ctx, bus, findUser{ID: 9}); !errors.Is(err, errNotFound) {
+		t.Errorf("Expected handler error to be returned, got %v", err)
+	}
+	if _, err := Request[findUser, string](ctx, bus, findUser{ID: 2}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected default timeout, got %v", err)
+	}
+	if _, err := Request[findUser, string](ctx, bus, findUser{ID: 3}); err == nil {
+		t.Errorf("Expected panicking handler to fail the request")
+	}
+	if _, err := Request[findUser, int](ctx, bus, findUser{ID: 1}); !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("Expected ErrUnexpectedResponse, got %v", err)
+	}
+	if _, err := bus.Request(ctx, "user.unknown", nil); !errors.Is(err, ErrNoRequestHandler) {
+		t.Errorf("Expected ErrNoRequestHandler, got %v", err)
+	}
+}
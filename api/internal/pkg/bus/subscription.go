@@ -0,0 +1,325 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/trace"
+)
+
+// SubscribeOption configures a subscription
+type SubscribeOption func(*Subscription)
+
+// WithName names the subscription in logs, defaults to the handler's type or
+// function name
+func WithName(name string) SubscribeOption {
+	return func(s *Subscription) {
+		s.name = name
+	}
+}
+
+// WithLogger logs handler panics and timeouts through log, usually the
+// subscribing module's logger
+func WithLogger(log *logger.Logger) SubscribeOption {
+	return func(s *Subscription) {
+		s.logger = log
+	}
+}
+
+// WithWorkers sets how many events of the subscription are handled concurrently.
+// Events are handled in publish order only with a single worker.
+func WithWorkers(n int) SubscribeOption {
+	return func(s *Subscription) {
+		if n > 0 {
+			s.workers = n
+		}
+	}
+}
+
+// WithGroup names the consumer group of the subscription on a remote
+// transport: of all processes subscribing with the same group only one
+// handles each event. It defaults to the subscription name.
+func WithGroup(group string) SubscribeOption {
+	return func(s *Subscription) {
+		s.group = group
+	}
+}
+
+// WithBroadcast makes every process handle the events of the subscription,
+// e.g. to evict a local cache, instead of one process per group
+func WithBroadcast() SubscribeOption {
+	return func(s *Subscription) {
+		s.broadcast = true
+	}
+}
+
+// WithTimeout sets how long the handler may run before the context of the
+// event, see Event.Context, is cancelled and the worker moves on to the next
+// event. Zero disables it.
+func WithTimeout(timeout time.Duration) SubscribeOption {
+	return func(s *Subscription) {
+		s.timeout = timeout
+	}
+}
+
+// Subscription is a handler with its own unbounded queue and workers. It is
+// returned by Subscribe and can be cancelled with Unsubscribe.
+type Subscription struct {
+	bus     *EventBus
+	pattern pattern
+	handler EventHandler
+	name    string
+	logger  *logger.Logger
+	workers int
+	timeout time.Duration
+
+	group     string
+	broadcast bool
+	// cancel detaches the subscription from a remote transport
+	cancel      func() error
+	unsubscribe sync.Once
+
+	inFlight atomic.Int64
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []delivery
+	closed bool
+	exited sync.WaitGroup
+}
+
+func newSubscription(bus *EventBus, p pattern, handler EventHandler, opts ...SubscribeOption) *Subscription {
+	s := &Subscription{
+		bus:     bus,
+		pattern: p,
+		handler: handler,
+		name:    handlerName(handler),
+		logger:  bus.logger,
+		workers: bus.cfg.Workers,
+		timeout: bus.cfg.HandlerTimeout,
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.broadcast {
+		s.group = ""
+	} else if s.group == "" {
+		s.group = strings.Join(strings.Fields(s.name), "_")
+	}
+
+	s.exited.Add(s.workers)
+	for i := 0; i < s.workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// delivery is a queued event. When result is set it receives the outcome of
+// the handler.
+type delivery struct {
+	event  Event
+	result chan<- error
+}
+
+// Pattern returns the event type or pattern the subscription listens to
+func (s *Subscription) Pattern() string {
+	return s.pattern.raw
+}
+
+// Name returns the name of the subscription's handler
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// Unsubscribe stops delivering new events to the subscription. Events already
+// queued are still handled in the background. Calling it more than once, or
+// from within the handler itself, is safe.
+func (s *Subscription) Unsubscribe() {
+	s.unsubscribe.Do(func() {
+		s.bus.remove(s)
+		if s.cancel != nil {
+			if err := s.cancel(); err != nil {
+				s.logError("Failed to unsubscribe from transport", "pattern", s.pattern.raw, "handler", s.name, "error", err)
+			}
+		}
+	})
+	s.stop()
+}
+
+// enqueue adds an event to the queue without blocking the dispatcher. It
+// reports false when the subscription no longer accepts events.
+func (s *Subscription) enqueue(event Event, result chan<- error) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return false
+	}
+	s.bus.wg.Add(1)
+	s.queue = append(s.queue, delivery{event: event, result: result})
+	s.mu.Unlock()
+	s.cond.Signal()
+	return true
+}
+
+// stop lets the workers exit once the queue is drained
+func (s *Subscription) stop() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// close stops the subscription and waits for its workers
+func (s *Subscription) close() {
+	s.stop()
+	s.exited.Wait()
+}
+
+func (s *Subscription) work() {
+	defer s.exited.Done()
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		d := s.queue[0]
+		s.queue[0] = delivery{}
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		s.inFlight.Add(1)
+		started := time.Now()
+		outcome, finished, err := s.run(d.event)
+		s.bus.metrics.handled(d.event.Type, s.name, outcome, time.Since(started))
+		s.inFlight.Add(-1)
+
+		if d.result != nil {
+			// The outbox must not retry the event while a handler that
+			// timed out is still running
+			go func(result chan<- error) {
+				<-finished
+				result <- err
+			}(d.result)
+		}
+		s.bus.wg.Done()
+	}
+}
+
+// Handler outcomes recorded in the metrics
+const (
+	OutcomeOK      = "ok"
+	OutcomeError   = "error"
+	OutcomePanic   = "panic"
+	OutcomeTimeout = "timeout"
+)
+
+type result struct {
+	outcome string
+	err     error
+}
+
+// finishedHandler is returned by run for handlers that already returned
+var finishedHandler = func() <-chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// run handles one event. At the timeout the context of the event is
+// cancelled and the worker stops waiting, but the handler still counts for
+// EventBus.Wait and Close until it returns, which closes finished.
+func (s *Subscription) run(event Event) (outcome string, finished <-chan struct{}, err error) {
+	if s.timeout <= 0 {
+		r := s.invoke(event)
+		return r.outcome, finishedHandler, r.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	event.ctx = ctx
+
+	done := make(chan result, 1)
+	exited := make(chan struct{})
+	s.bus.wg.Add(1)
+	s.exited.Add(1)
+	go func() {
+		defer s.exited.Done()
+		defer s.bus.wg.Done()
+		defer close(exited)
+		defer cancel()
+		done <- s.invoke(event)
+	}()
+
+	select {
+	case r := <-done:
+		return r.outcome, exited, r.err
+	case <-ctx.Done():
+		s.logError("Event handler timed out", eventFields(event, "handler", s.name, "timeout", s.timeout)...)
+		return OutcomeTimeout, exited, fmt.Errorf("handler %s timed out after %s", s.name, s.timeout)
+	}
+}
+
+// invoke calls the handler and recovers from panics
+func (s *Subscription) invoke(event Event) (r result) {
+	defer func() {
+		if p := recover(); p != nil {
+			s.logError("Event handler panicked", eventFields(event, "handler", s.name, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))...)
+			r = result{OutcomePanic, fmt.Errorf("handler %s panicked: %v", s.name, p)}
+		}
+	}()
+
+	if handler, ok := s.handler.(ErrorHandler); ok {
+		if err := handler.HandleEvent(event); err != nil {
+			s.logError("Event handler failed", eventFields(event, "handler", s.name, "error", err)...)
+			return result{OutcomeError, fmt.Errorf("handler %s failed: %w", s.name, err)}
+		}
+		return result{outcome: OutcomeOK}
+	}
+
+	s.handler.Handle(event)
+	return result{outcome: OutcomeOK}
+}
+
+// eventFields returns log fields identifying the event and its trace
+func eventFields(event Event, fields ...interface{}) []interface{} {
+	base := []interface{}{"event", event.Type}
+	if sc, ok := trace.FromContext(event.Context()); ok {
+		base = append(base, "trace_id", sc.TraceIDString())
+	}
+	return append(base, fields...)
+}
+
+func (s *Subscription) logError(msg string, fields ...interface{}) {
+	if s.logger != nil {
+		s.logger.Error(msg, fields...)
+		return
+	}
+	log.Println(append([]interface{}{msg}, fields...)...)
+}
+
+// handlerName returns the function name of func handlers and the type name of
+// other handlers
+func handlerName(handler EventHandler) string {
+	switch handler.(type) {
+	case EventHandlerFunc, ErrorHandlerFunc:
+		if f := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); f != nil {
+			return f.Name()
+		}
+	}
+	return fmt.Sprintf("%T", handler)
+}
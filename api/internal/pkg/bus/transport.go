@@ -0,0 +1,68 @@
+package bus
+
+import (
+	"sync"
+)
+
+// Transport carries events from publishers to subscriptions. The default
+// transport is an in-memory channel; a networked broker lets several
+// processes share events (see the natsbus package).
+type Transport interface {
+	// Publish sends an event to every bus connected to the transport
+	Publish(event Event) error
+	// Subscribe receives the events matching pattern. Of the subscriptions
+	// sharing a non-empty group across all processes, only one receives
+	// each event. Remote transports deliver payloads as json.RawMessage.
+	// receive must not block.
+	Subscribe(pattern, group string, receive func(Event)) (cancel func() error, err error)
+	// Close stops the transport once the events it accepted are handed over
+	Close() error
+}
+
+// memoryTransport is the in-process transport. Events are buffered in a
+// channel and fanned out by a single dispatcher to the bus' subscriptions.
+type memoryTransport struct {
+	events   chan Event
+	pending  *sync.WaitGroup
+	dispatch func(Event)
+	done     chan struct{}
+}
+
+func newMemoryTransport(size int, pending *sync.WaitGroup, dispatch func(Event)) *memoryTransport {
+	t := &memoryTransport{
+		events:   make(chan Event, size),
+		pending:  pending,
+		dispatch: dispatch,
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Publish queues the event, blocking while the channel is full
+func (t *memoryTransport) Publish(event Event) error {
+	t.pending.Add(1)
+	t.events <- event
+	return nil
+}
+
+// Subscribe is a no-op, the dispatcher routes through the bus' subscriptions
+func (t *memoryTransport) Subscribe(pattern, group string, receive func(Event)) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+// Close returns once queued events are dispatched
+func (t *memoryTransport) Close() error {
+	close(t.events)
+	<-t.done
+	return nil
+}
+
+func (t *memoryTransport) run() {
+	defer close(t.done)
+
+	for event := range t.events {
+		t.dispatch(event)
+		t.pending.Done()
+	}
+}
@@ -0,0 +1,119 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Named is implemented by event and request types that choose their own name
+// instead of the one derived from the type name
+type Named interface {
+	EventName() string
+}
+
+// NameOf returns the event name of T. Types implementing Named use their
+// EventName, other names are derived from the type name, so UserCreated and
+// *UserCreated are both published as "user.created".
+func NameOf[T any]() string {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// a pointer has the methods of both receivers
+	if named, ok := reflect.New(t).Interface().(Named); ok {
+		return named.EventName()
+	}
+	return eventName(t.Name())
+}
+
+// eventName turns a Go type name into a dotted event name,
+// e.g. UserCreated into "user.created" and HTTPRequestFailed into
+// "http.request.failed"
+func eventName(typeName string) string {
+	runes := []rune(typeName)
+	var b strings.Builder
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Publish publishes payload under the event name of T
+func Publish[T any](bus *EventBus, payload T) {
+	bus.Publish(Event{Type: NameOf[T](), Payload: payload})
+}
+
+// PublishContext publishes payload under the event name of T as part of the
+// trace in ctx
+func PublishContext[T any](ctx context.Context, bus *EventBus, payload T) {
+	bus.PublishContext(ctx, Event{Type: NameOf[T](), Payload: payload})
+}
+
+// PublishLocal publishes payload under the event name of T to the
+// subscriptions of this process, see EventBus.PublishLocal
+func PublishLocal[T any](bus *EventBus, payload T) {
+	bus.PublishLocal(Event{Type: NameOf[T](), Payload: payload})
+}
+
+// PublishTx writes payload to the outbox within tx under the event name of T,
+// see EventBus.PublishTx
+func PublishTx[T any](bus *EventBus, tx *gorm.DB, payload T) error {
+	return bus.PublishTx(tx, Event{Type: NameOf[T](), Payload: payload})
+}
+
+// Subscribe registers handler for the events of type T. The payload type is
+// registered for outbox decoding as well.
+func Subscribe[T any](bus *EventBus, handler func(T), opts ...SubscribeOption) *Subscription {
+	return SubscribeErr(bus, func(payload T) error {
+		handler(payload)
+		return nil
+	}, append([]SubscribeOption{WithName(funcName(handler))}, opts...)...)
+}
+
+// SubscribeErr registers a handler for the events of type T that can fail,
+// see ErrorHandler
+func SubscribeErr[T any](bus *EventBus, handler func(T) error, opts ...SubscribeOption) *Subscription {
+	return SubscribeContext(bus, func(_ context.Context, payload T) error {
+		return handler(payload)
+	}, append([]SubscribeOption{WithName(funcName(handler))}, opts...)...)
+}
+
+// SubscribeContext registers a handler for the events of type T that receives
+// the context of the trace the event was published in, see Event.Context
+func SubscribeContext[T any](bus *EventBus, handler func(context.Context, T) error, opts ...SubscribeOption) *Subscription {
+	name := NameOf[T]()
+
+	bus.registerPayloadType(name, reflect.TypeOf((*T)(nil)).Elem())
+
+	opts = append([]SubscribeOption{WithName(funcName(handler))}, opts...)
+	return bus.Subscribe(name, ErrorHandlerFunc(func(event Event) error {
+		payload, ok := event.Payload.(T)
+		if !ok {
+			return fmt.Errorf("unexpected payload %T for %s", event.Payload, name)
+		}
+		return handler(event.Context(), payload)
+	}), opts...)
+}
+
+// funcName returns the name of a function value
+func funcName(fn any) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return fmt.Sprintf("%T", fn)
+}
@@ -0,0 +1,56 @@
+package bus
+
+import (
+	"testing"
+)
+
+type UserCreated struct {
+	ID uint
+}
+
+type auditRecorded struct{}
+
+func (auditRecorded) EventName() string {
+	return "audit.recorded"
+}
+
+func TestEventNames(t *testing.T) {
+	tests := map[string]string{
+		NameOf[UserCreated]():          "user.created",
+		NameOf[*UserCreated]():         "user.created",
+		NameOf[auditRecorded]():        "audit.recorded",
+		NameOf[*auditRecorded]():       "audit.recorded",
+		eventName("HTTPRequestFailed"): "http.request.failed",
+	}
+	for got, want := range tests {
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestTypedPublishAndSubscribe(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var typed, untyped []uint
+	Subscribe(bus, func(e UserCreated) {
+		typed = append(typed, e.ID)
+	})
+	bus.SubscribeFunc("user.created", func(e Event) {
+		untyped = append(untyped, e.Payload.(UserCreated).ID)
+	})
+
+	Publish(bus, UserCreated{ID: 1})
+	bus.Publish(Event{Type: "user.created", Payload: UserCreated{ID: 2}})
+	// a mismatched payload is reported as a handler failure, not a panic
+	bus.Publish(Event{Type: "user.created", Payload: "not a user"})
+	bus.Wait()
+
+	if len(typed) != 2 || typed[0] != 1 || typed[1] != 2 {
+		t.Errorf("Expected typed handler to receive both events, got %v", typed)
+	}
+	if len(untyped) != 2 {
+		t.Errorf("Expected string subscription to receive typed events, got %v", untyped)
+	}
+}
@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrClosed is returned by stores used after Close
+var ErrClosed = errors.New("cache closed")
+
+// Store is a cache backend holding encoded values. A ttl of zero keeps the
+// value until it is deleted or evicted.
+type Store interface {
+	// Get returns the value of key and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes keys, missing keys are ignored
+	Delete(ctx context.Context, keys ...string) error
+
+	// Update atomically replaces the value of key with the value and ttl
+	// returned by fn, which receives the current value. fn runs again when
+	// another writer changed key in the meantime.
+	Update(ctx context.Context, key string, fn UpdateFunc) error
+
+	// Close releases the store's resources
+	Close() error
+}
+
+// UpdateFunc returns the new value of a key from its current value
+type UpdateFunc func(value []byte, found bool) ([]byte, time.Duration, error)
+
+// Config configures a Cache
+type Config struct {
+	// Namespace prefixes the keys of the cache, so caches sharing a store
+	// do not collide
+	Namespace string
+	// TTL is the lifetime of entries set without their own, zero keeps them
+	// until they are deleted or evicted
+	TTL time.Duration
+	// OnError is called when GetOrLoad ignores a failing store
+	OnError func(key string, err error)
+}
+
+// Cache stores values of type T, encoded as JSON, in a Store
+type Cache[T any] struct {
+	store Store
+	cfg   Config
+	group singleflight.Group
+}
+
+// New creates a cache of T values on store
+func New[T any](store Store, cfg Config) *Cache[T] {
+	return &Cache[T]{store: store, cfg: cfg}
+}
+
+// key returns the store key of key
+func (c *Cache[T]) key(key string) string {
+	if c.cfg.Namespace == "" {
+		return key
+	}
+	return c.cfg.Namespace + ":" + key
+}
+
+// Get returns the value of key and whether it was found
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, bool, error) {
+	var value T
+
+	data, found, err := c.store.Get(ctx, c.key(key))
+	if err != nil || !found {
+		return value, false, err
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, false, fmt.Errorf("decode cache entry %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// Set stores value under key. A ttl of zero uses the cache's TTL.
+func (c *Cache[T]) Set(ctx context.Context, key string, value T, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode cache entry %s: %w", key, err)
+	}
+	if ttl <= 0 {
+		ttl = c.cfg.TTL
+	}
+	return c.store.Set(ctx, c.key(key), data, ttl)
+}
+
+// Delete removes keys from the cache
+func (c *Cache[T]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	stored := make([]string, len(keys))
+	for i, key := range keys {
+		stored[i] = c.key(key)
+	}
+	return c.store.Delete(ctx, stored...)
+}
+
+// Update atomically replaces the value of key with the result of fn and
+// returns it. A ttl of zero uses the cache's TTL. fn may run more than once
+// when the store is shared and key changes concurrently.
+func (c *Cache[T]) Update(ctx context.Context, key string, fn func(value T, found bool) (T, time.Duration, error)) (T, error) {
+	var updated T
+	err := c.store.Update(ctx, c.key(key), func(data []byte, found bool) ([]byte, time.Duration, error) {
+		var value T
+		if found {
+			if err := json.Unmarshal(data, &value); err != nil {
+				return nil, 0, fmt.Errorf("decode cache entry %s: %w", key, err)
+			}
+		}
+		next, ttl, err := fn(value, found)
+		if err != nil {
+			return nil, 0, err
+		}
+		data, err = json.Marshal(next)
+		if err != nil {
+			return nil, 0, fmt.Errorf("encode cache entry %s: %w", key, err)
+		}
+		if ttl <= 0 {
+			ttl = c.cfg.TTL
+		}
+		updated = next
+		return data, ttl, nil
+	})
+	return updated, err
+}
+
+// GetOrLoad returns the cached value of key, or calls load and caches its
+// result for ttl (zero uses the cache's TTL). Concurrent misses of the same key
+// share a single call to load, which runs detached from the cancellation of
+// the caller that started it. The cache is best effort: a failing store is
+// reported to OnError and treated as a miss.
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) (T, error)) (T, error) {
+	value, found, err := c.Get(ctx, key)
+	if err != nil {
+		c.onError(key, err)
+	}
+	if found {
+		return value, nil
+	}
+
+	loaded := c.group.DoChan(c.key(key), func() (interface{}, error) {
+		ctx := context.WithoutCancel(ctx)
+		value, err := load(ctx)
+		if err != nil {
+			return value, err
+		}
+		if err := c.Set(ctx, key, value, ttl); err != nil {
+			c.onError(key, err)
+		}
+		return value, nil
+	})
+
+	var zero T
+	select {
+	case r := <-loaded:
+		if r.Err != nil {
+			return zero, r.Err
+		}
+		return r.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+func (c *Cache[T]) onError(key string, err error) {
+	if c.cfg.OnError != nil {
+		c.cfg.OnError(key, err)
+	}
+}
+
+// WithDefaultTTL returns store with values set without a ttl expiring after
+// ttl instead of never. The ttl can be changed later with SetDefaultTTL.
+func WithDefaultTTL(store Store, ttl time.Duration) Store {
+	s := &defaultTTLStore{Store: store}
+	s.ttl.Store(int64(ttl))
+	return s
+}
+
+// SetDefaultTTL changes the default ttl of a store returned by
+// WithDefaultTTL, it reports false for other stores
+func SetDefaultTTL(store Store, ttl time.Duration) bool {
+	s, ok := store.(*defaultTTLStore)
+	if ok {
+		s.ttl.Store(int64(ttl))
+	}
+	return ok
+}
+
+type defaultTTLStore struct {
+	Store
+	ttl atomic.Int64
+}
+
+func (s *defaultTTLStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = time.Duration(s.ttl.Load())
+	}
+	return s.Store.Set(ctx, key, value, ttl)
+}
+
+func (s *defaultTTLStore) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	return s.Store.Update(ctx, key, func(value []byte, found bool) ([]byte, time.Duration, error) {
+		next, ttl, err := fn(value, found)
+		if ttl <= 0 {
+			ttl = time.Duration(s.ttl.Load())
+		}
+		return next, ttl, err
+	})
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+type profile struct {
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+}
+
+// stores returns every backend, Redis backed by an in-process fake
+func stores(t *testing.T) map[string]Store {
+	server := miniredis.RunT(t)
+	redisStore, err := NewRedisStore("redis://"+server.Addr(), "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { redisStore.Close() })
+
+	memory := NewMemoryStore(time.Minute)
+	t.Cleanup(func() { memory.Close() })
+
+	return map[string]Store{"memory": memory, "redis": redisStore}
+}
+
+func TestCacheGetSetDelete(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			c := New[profile](store, Config{Namespace: "profiles", TTL: time.Minute})
+
+			if _, found, err := c.Get(ctx, "1"); err != nil || found {
+				t.Fatalf("Expected a miss, got found=%v err=%v", found, err)
+			}
+
+			want := profile{Name: "rafi", Score: 7}
+			if err := c.Set(ctx, "1", want, 0); err != nil {
+				t.Fatal(err)
+			}
+			got, found, err := c.Get(ctx, "1")
+			if err != nil || !found || got != want {
+				t.Fatalf("Expected %+v, got %+v found=%v err=%v", want, got, found, err)
+			}
+
+			if err := c.Delete(ctx, "1", "missing"); err != nil {
+				t.Fatal(err)
+			}
+			if _, found, _ := c.Get(ctx, "1"); found {
+				t.Errorf("Expected the entry to be deleted")
+			}
+		})
+	}
+}
+
+func TestCacheUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			c := New[profile](store, Config{Namespace: "profiles", TTL: time.Minute})
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 10; j++ {
+						_, err := c.Update(ctx, "1", func(p profile, found bool) (profile, time.Duration, error) {
+							p.Score++
+							return p, 0, nil
+						})
+						if err != nil {
+							t.Error(err)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			got, _, err := c.Get(ctx, "1")
+			if err != nil || got.Score != 100 {
+				t.Errorf("Expected 100 increments, got %d err=%v", got.Score, err)
+			}
+
+			failed := errors.New("failed")
+			if _, err := c.Update(ctx, "1", func(p profile, _ bool) (profile, time.Duration, error) {
+				return p, 0, failed
+			}); !errors.Is(err, failed) {
+				t.Errorf("Expected the error of fn, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	ctx := context.Background()
+
+	memory := NewMemoryStore(time.Minute)
+	defer memory.Close()
+	c := New[string](memory, Config{TTL: time.Hour})
+
+	if err := c.Set(ctx, "short", "value", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, found, _ := c.Get(ctx, "short"); found {
+		t.Errorf("Expected the entry to expire")
+	}
+
+	server := miniredis.RunT(t)
+	redisStore, err := NewRedisStore("redis://"+server.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisStore.Close()
+	rc := New[string](redisStore, Config{Namespace: "ns", TTL: time.Hour})
+
+	if err := rc.Set(ctx, "key", "value", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("ns:key"); ttl != time.Minute {
+		t.Errorf("Expected a TTL of 1m, got %s", ttl)
+	}
+	server.FastForward(2 * time.Minute)
+	if _, found, _ := rc.Get(ctx, "key"); found {
+		t.Errorf("Expected the entry to expire")
+	}
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			c := New[profile](store, Config{Namespace: "load"})
+
+			var calls atomic.Int32
+			release := make(chan struct{})
+			load := func(context.Context) (profile, error) {
+				calls.Add(1)
+				<-release
+				return profile{Name: "loaded"}, nil
+			}
+
+			var wg sync.WaitGroup
+			results := make(chan profile, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					p, err := c.GetOrLoad(ctx, "key", 0, load)
+					if err != nil {
+						t.Error(err)
+					}
+					results <- p
+				}()
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(results)
+
+			if n := calls.Load(); n != 1 {
+				t.Errorf("Expected concurrent misses to share one load, got %d", n)
+			}
+			for p := range results {
+				if p.Name != "loaded" {
+					t.Errorf("Unexpected value %+v", p)
+				}
+			}
+
+			// Cached now, load is not called again
+			if _, err := c.GetOrLoad(ctx, "key", 0, load); err != nil || calls.Load() != 1 {
+				t.Errorf("Expected a cache hit, calls=%d err=%v", calls.Load(), err)
+			}
+		})
+	}
+}
+
+func TestCacheGetOrLoadErrors(t *testing.T) {
+	ctx := context.Background()
+
+	memory := NewMemoryStore(time.Minute)
+	c := New[int](memory, Config{})
+
+	boom := errors.New("boom")
+	if _, err := c.GetOrLoad(ctx, "key", 0, func(context.Context) (int, error) { return 0, boom }); !errors.Is(err, boom) {
+		t.Errorf("Expected the load error, got %v", err)
+	}
+	if _, found, _ := c.Get(ctx, "key"); found {
+		t.Errorf("Failed loads must not be cached")
+	}
+
+	// A failing store is reported and bypassed
+	memory.Close()
+	var reported int
+	c = New[int](memory, Config{OnError: func(string, error) { reported++ }})
+	value, err := c.GetOrLoad(ctx, "key", 0, func(context.Context) (int, error) { return 42, nil })
+	if err != nil || value != 42 {
+		t.Errorf("Expected 42 from the loader, got %d err=%v", value, err)
+	}
+	if reported != 2 {
+		t.Errorf("Expected the failed read and write to be reported, got %d", reported)
+	}
+}
+
+func TestWithDefaultTTL(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	redisStore, err := NewRedisStore("redis://"+server.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisStore.Close()
+
+	c := New[int](WithDefaultTTL(redisStore, time.Hour), Config{})
+	if err := c.Set(ctx, "default", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "own", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("default"); ttl != time.Hour {
+		t.Errorf("Expected the default TTL of 1h, got %s", ttl)
+	}
+	if ttl := server.TTL("own"); ttl != time.Minute {
+		t.Errorf("Expected the entry's own TTL of 1m, got %s", ttl)
+	}
+}
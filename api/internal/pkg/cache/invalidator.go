@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/logger"
+)
+
+// PurgeFunc drops every entry tagged with one of tags
+type PurgeFunc func(ctx context.Context, tags ...string) error
+
+// Invalidator evicts cached data when domain events are published. Modules
+// declare at initialization which tags or keys an event makes stale. Every
+// process handles the events (see bus.WithBroadcast), so in-process caches
+// of every replica are evicted.
+type Invalidator struct {
+	event  *bus.EventBus
+	purge  PurgeFunc
+	logger *logger.Logger
+
+	mu            sync.Mutex
+	subscriptions []*bus.Subscription
+}
+
+// NewInvalidator creates an invalidator purging tags with purge
+func NewInvalidator(event *bus.EventBus, purge PurgeFunc, log *logger.Logger) *Invalidator {
+	return &Invalidator{event: event, purge: purge, logger: log}
+}
+
+// On purges the tags returned by tags for every event matching pattern, see
+// EventBus.Subscribe for patterns
+func (i *Invalidator) On(pattern string, tags func(event bus.Event) []string) {
+	i.add(i.event.Subscribe(pattern, bus.ErrorHandlerFunc(func(e bus.Event) error {
+		return i.purgeTags(e.Context(), tags(e))
+	}), i.options("cache.invalidate:"+pattern)...))
+}
+
+// InvalidateOn purges the tags returned by tags for every event of type T
+func InvalidateOn[T any](i *Invalidator, tags func(event T) []string) {
+	i.add(bus.SubscribeContext(i.event, func(ctx context.Context, e T) error {
+		return i.purgeTags(ctx, tags(e))
+	}, i.options("cache.invalidate:"+bus.NameOf[T]())...))
+}
+
+// EvictOn deletes the keys of c returned by keys for every event of type T
+func EvictOn[T, V any](i *Invalidator, c *Cache[V], keys func(event T) []string) {
+	i.add(bus.SubscribeContext(i.event, func(ctx context.Context, e T) error {
+		return c.Delete(ctx, keys(e)...)
+	}, i.options("cache.evict:"+bus.NameOf[T]())...))
+}
+
+// Close stops invalidating
+func (i *Invalidator) Close() {
+	i.mu.Lock()
+	subscriptions := i.subscriptions
+	i.subscriptions = nil
+	i.mu.Unlock()
+
+	for _, sub := range subscriptions {
+		sub.Unsubscribe()
+	}
+}
+
+func (i *Invalidator) purgeTags(ctx context.Context, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	return i.purge(ctx, tags...)
+}
+
+func (i *Invalidator) options(name string) []bus.SubscribeOption {
+	opts := []bus.SubscribeOption{bus.WithName(name), bus.WithBroadcast()}
+	if i.logger != nil {
+		opts = append(opts, bus.WithLogger(i.logger))
+	}
+	return opts
+}
+
+func (i *Invalidator) add(sub *bus.Subscription) {
+	i.mu.Lock()
+	i.subscriptions = append(i.subscriptions, sub)
+	i.mu.Unlock()
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"nanonime/internal/pkg/bus"
+)
+
+type UserUpdated struct {
+	ID string `json:"id"`
+}
+
+func TestInvalidator(t *testing.T) {
+	ctx := context.Background()
+	event := bus.NewEventBus()
+	defer event.Close()
+
+	var mu sync.Mutex
+	var purged []string
+	invalidator := NewInvalidator(event, func(_ context.Context, tags ...string) error {
+		mu.Lock()
+		purged = append(purged, tags...)
+		mu.Unlock()
+		return nil
+	}, nil)
+
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	users := New[string](store, Config{Namespace: "users"})
+	if err := users.Set(ctx, "7", "cached", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	InvalidateOn(invalidator, func(e UserUpdated) []string { return []string{"user:" + e.ID} })
+	EvictOn(invalidator, users, func(e UserUpdated) []string { return []string{e.ID} })
+	invalidator.On("user.*", func(bus.Event) []string { return []string{"users"} })
+
+	bus.Publish(event, UserUpdated{ID: "7"})
+	event.Wait()
+
+	sort.Strings(purged)
+	if len(purged) != 2 || purged[0] != "user:7" || purged[1] != "users" {
+		t.Errorf("Expected user:7 and users to be purged, got %v", purged)
+	}
+	if _, found, _ := users.Get(ctx, "7"); found {
+		t.Errorf("Expected the cached user to be evicted")
+	}
+
+	invalidator.Close()
+	purged = nil
+	bus.Publish(event, UserUpdated{ID: "8"})
+	event.Wait()
+	if len(purged) != 0 {
+		t.Errorf("Expected no purge after Close, got %v", purged)
+	}
+}
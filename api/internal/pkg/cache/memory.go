@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// MemoryStore keeps values in the process, expired entries are removed every
+// cleanup interval
+type MemoryStore struct {
+	cache  *cache.Cache
+	closed atomic.Bool
+
+	// mu serializes writes so Update sees no concurrent change
+	mu sync.Mutex
+}
+
+// NewMemoryStore creates an in-process store
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	return &MemoryStore{cache: cache.New(cache.NoExpiration, cleanupInterval)}
+}
+
+// Get returns the value of key and whether it was found
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	if s.closed.Load() {
+		return nil, false, ErrClosed
+	}
+	value, found := s.cache.Get(key)
+	if !found {
+		return nil, false, nil
+	}
+	return value.([]byte), true, nil
+}
+
+// Set stores value under key for ttl
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(key, value, ttl)
+	return nil
+}
+
+func (s *MemoryStore) set(key string, value []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = cache.NoExpiration
+	}
+	s.cache.Set(key, value, ttl)
+}
+
+// Delete removes keys
+func (s *MemoryStore) Delete(_ context.Context, keys ...string) error {
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.cache.Delete(key)
+	}
+	return nil
+}
+
+// Update replaces the value of key with the result of fn
+func (s *MemoryStore) Update(_ context.Context, key string, fn UpdateFunc) error {
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current []byte
+	value, found := s.cache.Get(key)
+	if found {
+		current = value.([]byte)
+	}
+	next, ttl, err := fn(current, found)
+	if err != nil {
+		return err
+	}
+	s.set(key, next, ttl)
+	return nil
+}
+
+// Close drops every entry
+func (s *MemoryStore) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	s.cache.Flush()
+	return nil
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Tags groups cache entries by tag so they can be purged together without
+// listing their keys. Every tag has a random version; entries are stored
+// under a key derived from the versions of their tags, so purging a tag
+// changes its version and entries stored under the old one are never read
+// again and expire with their TTL. Works on any Store.
+type Tags struct {
+	store     Store
+	namespace string
+}
+
+// NewTags creates the tag versions of namespace on store
+func NewTags(store Store, namespace string) *Tags {
+	return &Tags{store: store, namespace: namespace}
+}
+
+func (t *Tags) key(tag string) string {
+	return t.namespace + ":tag:" + tag
+}
+
+// Version returns a stamp combining the current versions of tags. Tags
+// without a version, never used or expired from the store, get a new one.
+func (t *Tags) Version(ctx context.Context, tags ...string) (string, error) {
+	versions := make([]string, len(tags))
+	for i, tag := range tags {
+		version, found, err := t.store.Get(ctx, t.key(tag))
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			if version, err = t.renew(ctx, tag); err != nil {
+				return "", err
+			}
+		}
+		versions[i] = string(version)
+	}
+	return strings.Join(versions, "."), nil
+}
+
+// Purge invalidates every entry stored under one of tags
+func (t *Tags) Purge(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		if _, err := t.renew(ctx, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renew sets a new random version for tag
+func (t *Tags) renew(ctx context.Context, tag string) ([]byte, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	version := []byte(hex.EncodeToString(b))
+	if err := t.store.Set(ctx, t.key(tag), version, 0); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
@@ -1,72 +1,311 @@
 package config
 
 import (
-	"nanonime/internal/pkg/jwt"
-	"log"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 
+	"nanonime/internal/pkg/logger"
+
 	"github.com/spf13/viper"
 )
 
+// EnvPrefix prefixes the environment variables overriding configuration
+// keys: database.db_host is read from NANONIME_DATABASE_DB_HOST
+const EnvPrefix = "NANONIME"
+
+// Config is the configuration of the application, loaded once at startup
+// by Load and handed to the application and its modules
 type Config struct {
-	filename string
+	Server   ServerConfig   `mapstructure:"server"`
+	Log      logger.Config  `mapstructure:"log"`
+	Database DatabaseConfig `mapstructure:"database"`
+	Pool     PoolConfig     `mapstructure:"pool"`
+	JWT      JWTConfig      `mapstructure:"jwt"`
+	Bus      BusConfig      `mapstructure:"bus"`
+	Cache    CacheConfig    `mapstructure:"cache"`
+	Mail     MailConfig     `mapstructure:"mail"`
+	Secrets  SecretsConfig  `mapstructure:"secrets"`
+	// Features are feature flags, see Feature
+	Features map[string]bool `mapstructure:"features"`
+
+	// File is the configuration file read, empty when configured only
+	// through the environment
+	File string `mapstructure:"-"`
+
+	// v holds the [modules.<name>] sections decoded by Module
+	v *viper.Viper
 }
 
-func NewConfig(filename string) Config {
-	return Config{filename: filename}
+// ServerConfig is the [server] section
+type ServerConfig struct {
+	AppName    string `mapstructure:"app_name"`
+	Mode       string `mapstructure:"mode"`
+	Port       string `mapstructure:"port"`
+	APIVersion string `mapstructure:"api_version"`
+	// HTTPTimeout is the read and write timeout in seconds
+	HTTPTimeout int `mapstructure:"http_timeout"`
+	// ShutdownTimeout is the graceful shutdown deadline in seconds
+	ShutdownTimeout int `mapstructure:"shutdown_timeout"`
+	// CacheExpired is the default lifetime of cached entries in minutes
+	CacheExpired int `mapstructure:"cache_expired"`
+	// CachePurged is the cleanup interval of the memory cache in minutes
+	CachePurged     int    `mapstructure:"cache_purged"`
+	TLSEnabled      bool   `mapstructure:"tls_enabled"`
+	TLSCertFile     string `mapstructure:"tls_cert_file"`
+	TLSKeyFile      string `mapstructure:"tls_key_file"`
+	TLSMinVersion   string `mapstructure:"tls_min_version"`
+	TLSRedirectPort string `mapstructure:"tls_redirect_port"`
+	// CORSOrigins are the origins allowed to call the API, "*" allows all
+	CORSOrigins []string `mapstructure:"cors_origins"`
+	// RateLimit is the number of requests per second allowed for each
+	// client IP, zero disables the limit
+	RateLimit float64 `mapstructure:"rate_limit"`
+	RateBurst int     `mapstructure:"rate_burst"`
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers name the client
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
-func (c *Config) Initialize() error {
 
-	configName := filepath.Base(c.filename)
+// DatabaseConfig is the [database] section
+type DatabaseConfig struct {
+	Driver   string `mapstructure:"db_driver"`
+	Host     string `mapstructure:"db_host"`
+	Port     string `mapstructure:"db_port"`
+	Name     string `mapstructure:"db_name"`
+	Username string `mapstructure:"db_username"`
+	Password Secret `mapstructure:"db_password"`
+	// MigrateOnStart applies pending migrations at startup, otherwise they
+	// are applied with the migrate up command
+	MigrateOnStart bool `mapstructure:"migrate_on_start"`
+	// MigrateLockTimeout is how long to wait in seconds for the migrations
+	// of another replica
+	MigrateLockTimeout int `mapstructure:"migrate_lock_timeout"`
+}
 
-	configExtension := filepath.Ext(c.filename)
-	configExtension = strings.TrimPrefix(configExtension, ".")
+// PoolConfig is the [pool] section
+type PoolConfig struct {
+	ConnIdle int `mapstructure:"conn_idle"`
+	ConnMax  int `mapstructure:"conn_max"`
+	// ConnLifetime is the maximum lifetime of a connection in minutes
+	ConnLifetime int `mapstructure:"conn_lifetime"`
+}
 
-	viper.SetConfigName(configName)
-	viper.SetConfigType(configExtension)
-	viper.AddConfigPath(filepath.Dir(c.filename))
+// JWTConfig is the [jwt] section
+type JWTConfig struct {
+	// DayExpired is the lifetime of refresh tokens in days
+	DayExpired int `mapstructure:"day_expired"`
+	// AccessTokenMinutes is the lifetime of access tokens
+	AccessTokenMinutes int            `mapstructure:"access_token_minutes"`
+	Algorithm          string         `mapstructure:"algorithm"`
+	SignatureKey       Secret         `mapstructure:"signature_key"`
+	SigningKeyID       string         `mapstructure:"signing_key_id"`
+	Keys               []JWTKeyConfig `mapstructure:"keys"`
+}
 
-	viper.AutomaticEnv()
-	err := viper.ReadInConfig()
+// JWTKeyConfig is an entry of [[jwt.keys]]
+type JWTKeyConfig struct {
+	ID             string `mapstructure:"id"`
+	Algorithm      string `mapstructure:"algorithm"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+}
 
-	if err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			return err
-		}
-		return err
-	}
+// BusConfig is the [bus] section, durations in seconds unless noted
+type BusConfig struct {
+	QueueSize             int    `mapstructure:"queue_size"`
+	Workers               int    `mapstructure:"workers"`
+	HandlerTimeout        int    `mapstructure:"handler_timeout"`
+	RequestTimeout        int    `mapstructure:"request_timeout"`
+	Transport             string `mapstructure:"transport"`
+	NatsURL               Secret `mapstructure:"nats_url"`
+	NatsSubjectPrefix     string `mapstructure:"nats_subject_prefix"`
+	Mode                  string `mapstructure:"mode"`
+	OutboxPollIntervalMs  int    `mapstructure:"outbox_poll_interval_ms"`
+	OutboxBatchSize       int    `mapstructure:"outbox_batch_size"`
+	OutboxMaxAttempts     int    `mapstructure:"outbox_max_attempts"`
+	OutboxRetryBackoff    int    `mapstructure:"outbox_retry_backoff"`
+	OutboxMaxRetryBackoff int    `mapstructure:"outbox_max_retry_backoff"`
+	OutboxClaimTimeout    int    `mapstructure:"outbox_claim_timeout"`
+}
 
-	return nil
+// CacheConfig is the [cache] section
+type CacheConfig struct {
+	Driver   string `mapstructure:"driver"`
+	RedisURL Secret `mapstructure:"redis_url"`
+	// KeyPrefix prefixes every Redis key, defaults to "<app_name>:"
+	KeyPrefix      string `mapstructure:"key_prefix"`
+	HTTPTTLSeconds int    `mapstructure:"http_ttl_seconds"`
 }
 
-func checkKey(key string) {
-	if !viper.IsSet(key) {
-		log.Fatalf("Configuration key %s not found; aborting \n", key)
-		os.Exit(1)
-	}
+// MailConfig is the [mail] section
+type MailConfig struct {
+	Driver       string `mapstructure:"driver"`
+	From         string `mapstructure:"from"`
+	OutputDir    string `mapstructure:"output_dir"`
+	SMTPHost     string `mapstructure:"smtp_host"`
+	SMTPPort     string `mapstructure:"smtp_port"`
+	SMTPUsername string `mapstructure:"smtp_username"`
+	SMTPPassword Secret `mapstructure:"smtp_password"`
+	BaseURL      string `mapstructure:"base_url"`
 }
 
-func GetString(key string) string {
-	checkKey(key)
-	return viper.GetString(key)
+// SecretsConfig is the [secrets] section. File is an optional secrets file
+// encrypted with EncryptSecrets, merged over the configuration file and
+// decrypted with Key, usually set through NANONIME_SECRETS_KEY or key_file.
+type SecretsConfig struct {
+	File string `mapstructure:"file"`
+	Key  Secret `mapstructure:"key"`
 }
 
-func GetInt(key string) int {
-	checkKey(key)
-	return viper.GetInt(key)
+// Default returns the configuration used for keys that are not set
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			AppName:         "nanonime",
+			Mode:            "info",
+			Port:            "8080",
+			APIVersion:      "1",
+			HTTPTimeout:     60,
+			ShutdownTimeout: 15,
+			CacheExpired:    24,
+			CachePurged:     60,
+			TLSMinVersion:   "1.2",
+			CORSOrigins:     []string{"*"},
+			RateBurst:       20,
+		},
+		Log: logger.DefaultConfig(),
+		Database: DatabaseConfig{
+			Driver:             "mysql",
+			MigrateOnStart:     true,
+			MigrateLockTimeout: 60,
+		},
+		Pool: PoolConfig{
+			ConnIdle:     10,
+			ConnMax:      100,
+			ConnLifetime: 60,
+		},
+		JWT: JWTConfig{
+			DayExpired:         60,
+			AccessTokenMinutes: 15,
+			Algorithm:          "HS256",
+		},
+		Bus: BusConfig{
+			QueueSize:             100,
+			Workers:               1,
+			HandlerTimeout:        30,
+			RequestTimeout:        5,
+			Transport:             "memory",
+			NatsURL:               "nats://127.0.0.1:4222",
+			Mode:                  "memory",
+			OutboxPollIntervalMs:  1000,
+			OutboxBatchSize:       50,
+			OutboxMaxAttempts:     10,
+			OutboxRetryBackoff:    5,
+			OutboxMaxRetryBackoff: 600,
+			OutboxClaimTimeout:    300,
+		},
+		Cache: CacheConfig{
+			Driver:         "memory",
+			RedisURL:       "redis://localhost:6379/0",
+			HTTPTTLSeconds: 60,
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "NanoNime <no-reply@localhost>",
+			SMTPPort: "587",
+		},
+	}
 }
 
-func GetBool(key string) bool {
-	checkKey(key)
-	return viper.GetBool(key)
+// Load reads the configuration file, applies the NANONIME_ environment
+// overrides, reads secrets from files and validates the result. A missing file is not an error so the
+// application can be configured through the environment alone; every
+// invalid value is reported in the returned error.
+func Load(filename string) (*Config, error) {
+	v := viper.New()
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	if err := bindEnv(v, reflect.TypeOf(Config{}), ""); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if filename != "" {
+		v.SetConfigFile(filename)
+		v.SetConfigType(strings.TrimPrefix(filepath.Ext(filename), "."))
+		err := v.ReadInConfig()
+		switch {
+		case err == nil:
+			cfg.File = filename
+		case errors.Is(err, os.ErrNotExist):
+		default:
+			return nil, fmt.Errorf("read %s: %w", filename, err)
+		}
+	}
+
+	if err := mergeSecretsFile(v); err != nil {
+		return nil, err
+	}
+	moveLegacySections(v)
+
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("decode configuration: %w", err)
+	}
+	if err := loadSecretFiles(v, reflect.ValueOf(&cfg).Elem(), ""); err != nil {
+		return nil, err
+	}
+	cfg.v = v
+	if cfg.Cache.KeyPrefix == "" {
+		cfg.Cache.KeyPrefix = cfg.Server.AppName + ":"
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Feature reports whether the feature flag name is on under [features].
+// Flag names are case insensitive.
+func (c *Config) Feature(name string) bool {
+	return c.Features[strings.ToLower(name)]
 }
 
-func GetJWTService() jwt.JWT {
-	signatureKey := GetString("jwt.signature_key")
-	if signatureKey == "" {
-		panic("JWT signature key not found in configuration")
+// bindEnv registers the environment variable of every key of t, so keys
+// missing from the file are still read from the environment
+func bindEnv(v *viper.Viper, t reflect.Type, prefix string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := bindEnv(v, field.Type, key+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.Type.Kind() == reflect.Map ||
+			field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
+			// tables such as [features] and [[jwt.keys]] are only read from the file
+			continue
+		}
+		if err := v.BindEnv(key); err != nil {
+			return err
+		}
+		if field.Type == secretType {
+			if err := v.BindEnv(key + "_file"); err != nil {
+				return err
+			}
+		}
 	}
-	return jwt.NewJWTImpl(signatureKey, 7)
+	return nil
 }
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+[server]
+port = "9090"
+
+[database]
+db_host = "db.internal"
+db_port = "3306"
+db_name = "nanonime"
+db_username = "nanonime"
+
+[jwt]
+signature_key = "secret"
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoad(t *testing.T) {
+	file := writeConfig(t, testConfig)
+	t.Setenv("NANONIME_DATABASE_DB_HOST", "db.override")
+	t.Setenv("NANONIME_BUS_WORKERS", "4")
+
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File != file {
+		t.Errorf("Expected File %q, got %q", file, cfg.File)
+	}
+	if cfg.Server.Port != "9090" {
+		t.Errorf("Expected the port from the file, got %q", cfg.Server.Port)
+	}
+	if cfg.Database.Host != "db.override" || cfg.Bus.Workers != 4 {
+		t.Errorf("Expected environment overrides, got host %q and %d workers", cfg.Database.Host, cfg.Bus.Workers)
+	}
+	if cfg.Pool.ConnMax != 100 || cfg.Cache.KeyPrefix != "nanonime:" {
+		t.Errorf("Expected defaults for missing keys, got conn_max %d and key_prefix %q", cfg.Pool.ConnMax, cfg.Cache.KeyPrefix)
+	}
+}
+
+func TestLoadFromEnvironment(t *testing.T) {
+	t.Setenv("NANONIME_DATABASE_DB_HOST", "localhost")
+	t.Setenv("NANONIME_DATABASE_DB_PORT", "5432")
+	t.Setenv("NANONIME_DATABASE_DB_DRIVER", "postgres")
+	t.Setenv("NANONIME_DATABASE_DB_NAME", "nanonime")
+	t.Setenv("NANONIME_DATABASE_DB_USERNAME", "nanonime")
+	t.Setenv("NANONIME_JWT_SIGNATURE_KEY", "secret")
+
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File != "" || cfg.Database.Driver != "postgres" {
+		t.Errorf("Expected an environment-only configuration, got file %q and driver %q", cfg.File, cfg.Database.Driver)
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	file := writeConfig(t, testConfig+`
+[cache]
+driver = "memcached"
+`)
+	t.Setenv("NANONIME_DATABASE_DB_HOST", " ")
+	t.Setenv("NANONIME_SERVER_PORT", "http")
+
+	_, err := Load(file)
+	if err == nil {
+		t.Fatal("Expected an invalid configuration")
+	}
+	for _, key := range []string{"server.port", "database.db_host", "cache.driver"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected an error for %s, got %v", key, err)
+		}
+	}
+}
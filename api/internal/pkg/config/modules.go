@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// ModuleConfig is implemented by module settings validating themselves
+type ModuleConfig interface {
+	// Validate reports the invalid settings to v, keys are relative to the
+	// module's section
+	Validate(v *Validator)
+}
+
+// legacySections are sections that moved to [modules.<name>], keyed by
+// their old name. Files still using the old section keep working.
+var legacySections = map[string]string{
+	"auth": "auth",
+}
+
+func moveLegacySections(v *viper.Viper) {
+	for old, name := range legacySections {
+		if !v.IsSet(old) || v.IsSet("modules."+name) {
+			continue
+		}
+		v.MergeConfigMap(map[string]interface{}{
+			"modules": map[string]interface{}{name: v.GetStringMap(old)},
+		})
+	}
+}
+
+// ModuleEnabled reports whether the module name is enabled, modules are
+// disabled with enabled = false under [modules.<name>]
+func (c *Config) ModuleEnabled(name string) bool {
+	if c.v == nil {
+		return true
+	}
+	key := "modules." + name + ".enabled"
+	c.v.BindEnv(key)
+	return !c.v.IsSet(key) || c.v.GetBool(key)
+}
+
+// Modules returns the names of the [modules.<name>] sections
+func (c *Config) Modules() []string {
+	if c.v == nil {
+		return nil
+	}
+	names := make([]string, 0)
+	for name := range c.v.GetStringMap("modules") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Module decodes the [modules.<name>] section into out, a pointer to a
+// struct holding the module's defaults. Keys are overridden by environment
+// variables such as NANONIME_MODULES_AUTH_LOCKOUT_THRESHOLD and Secret keys
+// can be read from files as in the rest of the configuration. When out
+// implements ModuleConfig its errors are returned.
+func (c *Config) Module(name string, out interface{}) error {
+	prefix := "modules." + name
+	t := reflect.TypeOf(out)
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%s: settings must be a pointer to a struct, got %T", prefix, out)
+	}
+
+	if c.v != nil {
+		if err := bindEnv(c.v, t.Elem(), prefix+"."); err != nil {
+			return err
+		}
+
+		// AllSettings, unlike Get, includes the environment overrides
+		modules, _ := c.v.AllSettings()["modules"].(map[string]interface{})
+		section, _ := modules[name].(map[string]interface{})
+
+		sub := viper.New()
+		if err := sub.MergeConfigMap(section); err != nil {
+			return fmt.Errorf("%s: %w", prefix, err)
+		}
+		if err := sub.Unmarshal(out); err != nil {
+			return fmt.Errorf("decode %s: %w", prefix, err)
+		}
+		if err := loadSecretFiles(c.v, reflect.ValueOf(out).Elem(), prefix+"."); err != nil {
+			return err
+		}
+	}
+
+	if settings, ok := out.(ModuleConfig); ok {
+		v := NewValidator(prefix + ".")
+		settings.Validate(v)
+		return v.Err()
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type searchConfig struct {
+	Engine  string        `mapstructure:"engine"`
+	Limit   int           `mapstructure:"limit"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	APIKey  Secret        `mapstructure:"api_key"`
+}
+
+func (c searchConfig) Validate(v *Validator) {
+	v.OneOf("engine", c.Engine, "sql", "meili")
+	v.Positive("limit", c.Limit)
+}
+
+func TestModule(t *testing.T) {
+	file := writeConfig(t, testConfig+`
+[modules.search]
+engine = "meili"
+timeout = "2s"
+
+[modules.events]
+enabled = false
+`)
+	t.Setenv("NANONIME_MODULES_SEARCH_API_KEY", "key")
+	t.Setenv("NANONIME_MODULES_USER_ENABLED", "false")
+
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := searchConfig{Engine: "sql", Limit: 20}
+	if err := cfg.Module("search", &search); err != nil {
+		t.Fatal(err)
+	}
+	if search.Engine != "meili" || search.Limit != 20 || search.Timeout != 2*time.Second || search.APIKey.Reveal() != "key" {
+		t.Errorf("Unexpected settings %+v", search)
+	}
+
+	if !cfg.ModuleEnabled("search") || cfg.ModuleEnabled("events") || cfg.ModuleEnabled("user") {
+		t.Errorf("Expected only events and user to be disabled")
+	}
+	if names := strings.Join(cfg.Modules(), ","); names != "events,search" {
+		t.Errorf("Unexpected module sections %s", names)
+	}
+
+	t.Setenv("NANONIME_MODULES_SEARCH_LIMIT", "0")
+	err = cfg.Module("search", &searchConfig{})
+	if err == nil || !strings.Contains(err.Error(), "modules.search.limit") || strings.Contains(err.Error(), "engine") {
+		t.Errorf("Expected only modules.search.limit to be invalid, got %v", err)
+	}
+}
+
+func TestModuleLegacySection(t *testing.T) {
+	file := writeConfig(t, testConfig+`
+[auth]
+lockout_threshold = 5
+`)
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var settings struct {
+		LockoutThreshold int `mapstructure:"lockout_threshold"`
+	}
+	if err := cfg.Module("auth", &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.LockoutThreshold != 5 {
+		t.Errorf("Expected [auth] to be read as [modules.auth], got %d", settings.LockoutThreshold)
+	}
+}
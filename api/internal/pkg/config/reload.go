@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"nanonime/internal/pkg/logger"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Reloaded is published on the event bus after a reload was applied. It only
+// reaches the subscribers of the process that reloaded.
+type Reloaded struct {
+	// Changed are the keys whose value changed, e.g. "log.level"
+	Changed []string `json:"changed"`
+}
+
+// EventName names the event "config.reloaded"
+func (Reloaded) EventName() string {
+	return "config.reloaded"
+}
+
+// withReloadable returns c with the values of next for the settings applied
+// while running. Other changes only take effect after a restart.
+func (c Config) withReloadable(next *Config) Config {
+	c.Log.Level = next.Log.Level
+	c.Server.CacheExpired = next.Server.CacheExpired
+	c.Server.CORSOrigins = next.Server.CORSOrigins
+	c.Server.RateLimit = next.Server.RateLimit
+	c.Server.RateBurst = next.Server.RateBurst
+	c.Server.TrustedProxies = next.Server.TrustedProxies
+	c.Cache.HTTPTTLSeconds = next.Cache.HTTPTTLSeconds
+	c.Features = next.Features
+	return c
+}
+
+// Watcher reloads the configuration when its file changes or the process
+// receives SIGHUP. A configuration failing to load or validate, or a missing
+// file, is rejected and the previous one is kept.
+type Watcher struct {
+	file    string
+	logger  *logger.Logger
+	current atomic.Pointer[Config]
+
+	// mu serializes reloads and their listeners
+	mu        sync.Mutex
+	listeners []func(cfg *Config, changed []string)
+
+	signals   chan os.Signal
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWatcher watches the file cfg was loaded from
+func NewWatcher(cfg *Config, log *logger.Logger) *Watcher {
+	w := &Watcher{
+		file:    cfg.File,
+		logger:  log,
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+	w.current.Store(cfg)
+	return w
+}
+
+// Current returns the configuration in effect
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// OnReload calls fn with the new configuration and the changed keys after
+// every applied reload
+func (w *Watcher) OnReload(fn func(cfg *Config, changed []string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Reload loads the configuration again and applies the changed settings
+// that can change while running. It returns the applied keys, and the error
+// of a rejected configuration. Unlike at startup the watched file must exist,
+// an editor or a ConfigMap update briefly removing it must not reset the
+// settings to their defaults.
+func (w *Watcher) Reload() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	next, err := w.load()
+	if err != nil {
+		w.logger.Warn("Configuration reload rejected, keeping the previous configuration", "error", err)
+		return nil, err
+	}
+
+	current := w.Current()
+	applied := current.withReloadable(next)
+	if restart := Diff(&applied, next); len(restart) > 0 {
+		w.logger.Warn("Configuration changes need a restart", "keys", restart)
+	}
+
+	changed := Diff(current, &applied)
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	w.current.Store(&applied)
+	w.logger.Info("Configuration reloaded", "changed", changed)
+	for _, fn := range w.listeners {
+		fn(&applied, changed)
+	}
+	return changed, nil
+}
+
+// load loads the watched file, which must exist
+func (w *Watcher) load() (*Config, error) {
+	if w.file == "" {
+		return Load("")
+	}
+	missing := fmt.Errorf("configuration file %s: %w", w.file, os.ErrNotExist)
+	if _, err := os.Stat(w.file); errors.Is(err, os.ErrNotExist) {
+		return nil, missing
+	}
+
+	next, err := Load(w.file)
+	if err != nil {
+		return nil, err
+	}
+	// the file was removed between the check and the read
+	if next.File == "" {
+		return nil, missing
+	}
+	return next, nil
+}
+
+// Watch starts reloading on changes of the file and on SIGHUP until Close
+func (w *Watcher) Watch() {
+	if w.file != "" {
+		v := viper.New()
+		v.SetConfigFile(w.file)
+		v.OnConfigChange(func(fsnotify.Event) {
+			if !w.closed() {
+				w.Reload()
+			}
+		})
+		v.WatchConfig()
+	}
+
+	signal.Notify(w.signals, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-w.signals:
+				w.logger.Info("Received SIGHUP, reloading configuration")
+				w.Reload()
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops reloading
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		signal.Stop(w.signals)
+		close(w.done)
+	})
+}
+
+func (w *Watcher) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Diff returns the keys whose value differs between a and b
+func Diff(a, b *Config) []string {
+	return diff(reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), "", nil)
+}
+
+func diff(a, b reflect.Value, prefix string, keys []string) []string {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			keys = diff(a.Field(i), b.Field(i), key+".", keys)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"nanonime/internal/pkg/logger"
+)
+
+func TestWatcherReload(t *testing.T) {
+	file := writeConfig(t, testConfig)
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logCfg := logger.DefaultConfig()
+	logCfg.OutputPath = filepath.Join(t.TempDir(), "app.log")
+	log, err := logger.NewLogger(logCfg, "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := NewWatcher(cfg, log)
+	defer watcher.Close()
+
+	var notified []string
+	watcher.OnReload(func(cfg *Config, changed []string) {
+		notified = changed
+	})
+
+	// database.db_host needs a restart, the other keys are applied
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(testConfig + `
+[log]
+level = "debug"
+
+[features]
+New_Search = true
+`)
+	t.Setenv("NANONIME_DATABASE_DB_HOST", "db.other")
+
+	changed, err := watcher.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"log.level", "features"}
+	if !reflect.DeepEqual(changed, expected) || !reflect.DeepEqual(notified, expected) {
+		t.Errorf("Expected %v to change, got %v and notified %v", expected, changed, notified)
+	}
+	current := watcher.Current()
+	if current.Log.Level != "debug" || !current.Feature("new_search") || current.Database.Host != "db.internal" {
+		t.Errorf("Unexpected configuration after reload: level %q, host %q", current.Log.Level, current.Database.Host)
+	}
+
+	// an invalid configuration keeps the previous one
+	notified = nil
+	write(testConfig + "\n[log]\nlevel = \"verbose\"\n")
+	if _, err := watcher.Reload(); err == nil {
+		t.Errorf("Expected an invalid configuration to be rejected")
+	}
+	if watcher.Current() != current || notified != nil {
+		t.Errorf("Expected the previous configuration to be kept")
+	}
+
+	// a missing file keeps the previous configuration instead of the defaults
+	write(testConfig + "\n[log]\nlevel = \"debug\"\n")
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watcher.Reload(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing file to be rejected, got %v", err)
+	}
+	if watcher.Current() != current || notified != nil {
+		t.Errorf("Expected the previous configuration to be kept")
+	}
+}
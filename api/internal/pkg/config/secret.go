@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	redacted = "[REDACTED]"
+
+	// secretsHeader starts every encrypted secrets file
+	secretsHeader = "NANONIME-SECRETS-V1"
+)
+
+// Secret is a configuration value such as a password or a signing key. It
+// prints as [REDACTED] with fmt, in logs and in JSON, Reveal returns the
+// value itself.
+//
+// Every Secret key can also be read from a file by setting the key with a
+// _file suffix, e.g. db_password_file = "/run/secrets/db_password".
+type Secret string
+
+// Reveal returns the secret value
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String redacts the secret, an empty secret stays empty
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString redacts the secret in %#v
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+// MarshalJSON redacts the secret
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// loadSecretFiles replaces every Secret of rv whose key has a _file
+// counterpart with the content of that file, without its trailing newline
+func loadSecretFiles(v *viper.Viper, rv reflect.Value, prefix string) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := loadSecretFiles(v, rv.Field(i), key+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.Type != secretType {
+			continue
+		}
+
+		file := v.GetString(key + "_file")
+		if file == "" {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("%s_file: %w", key, err)
+		}
+		rv.Field(i).SetString(strings.TrimRight(string(content), "\r\n"))
+	}
+	return nil
+}
+
+// mergeSecretsFile merges the encrypted file named by secrets.file into v,
+// decrypted with secrets.key
+func mergeSecretsFile(v *viper.Viper) error {
+	file := v.GetString("secrets.file")
+	if file == "" {
+		return nil
+	}
+
+	key := v.GetString("secrets.key")
+	if keyFile := v.GetString("secrets.key_file"); keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("secrets.key_file: %w", err)
+		}
+		key = string(content)
+	}
+	if strings.TrimSpace(key) == "" {
+		return fmt.Errorf("secrets.key: is required to read %s", file)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("secrets.file: %w", err)
+	}
+	plain, err := DecryptSecrets(key, data)
+	if err != nil {
+		return fmt.Errorf("secrets.file %s: %w", file, err)
+	}
+
+	// Parse with a viper of its own so v keeps the type of its config file
+	secrets := viper.New()
+	secrets.SetConfigType("toml")
+	if err := secrets.ReadConfig(bytes.NewReader(plain)); err != nil {
+		return fmt.Errorf("secrets.file %s: %w", file, err)
+	}
+	return v.MergeConfigMap(secrets.AllSettings())
+}
+
+// EncryptSecrets seals a TOML document with AES-256-GCM for secrets.file.
+// key is 32 bytes encoded in base64, e.g. the output of openssl rand -base64 32.
+func EncryptSecrets(key string, plain []byte) ([]byte, error) {
+	aead, err := secretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(secretsHeader))
+	return []byte(secretsHeader + "\n" + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// DecryptSecrets opens a document sealed by EncryptSecrets
+func DecryptSecrets(key string, data []byte) ([]byte, error) {
+	aead, err := secretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header, body, _ := strings.Cut(string(data), "\n")
+	if strings.TrimSpace(header) != secretsHeader {
+		return nil, errors.New("not an encrypted secrets file")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(body))
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("truncated secrets file")
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(secretsHeader))
+	if err != nil {
+		return nil, errors.New("wrong key or corrupted secrets file")
+	}
+	return plain, nil
+}
+
+func secretsCipher(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("secrets key must be 32 bytes encoded in base64")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"nanonime/internal/pkg/jwt"
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/mailer"
+)
+
+// Service builds the token signer. With algorithm HS256 (the default) tokens
+// are signed with signature_key. With RS256 or EdDSA they are signed with the
+// [[jwt.keys]] entry named by signing_key_id, every other entry is accepted
+// for verification so tokens survive a key rotation.
+func (c JWTConfig) Service() (jwt.JWT, error) {
+	if c.Algorithm == jwt.AlgorithmHS256 {
+		if c.SignatureKey == "" {
+			return nil, fmt.Errorf("jwt.signature_key is required for HS256")
+		}
+		keys, err := jwt.NewKeySet(c.SigningKeyID, jwt.NewHMACKey(c.SigningKeyID, []byte(c.SignatureKey.Reveal())))
+		if err != nil {
+			return nil, err
+		}
+		return jwt.NewJWTWithKeys(keys, c.AccessTokenTTL()), nil
+	}
+
+	keys := make([]*jwt.Key, 0, len(c.Keys))
+	for _, kc := range c.Keys {
+		if kc.Algorithm == "" {
+			kc.Algorithm = c.Algorithm
+		}
+		key, err := jwt.LoadKey(kc.ID, kc.Algorithm, kc.PrivateKeyFile, kc.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	keySet, err := jwt.NewKeySet(c.SigningKeyID, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep accepting HS256 tokens issued before the switch until they expire
+	if c.SignatureKey != "" {
+		keySet.SetLegacyKey(jwt.NewHMACKey("", []byte(c.SignatureKey.Reveal())))
+	}
+
+	return jwt.NewJWTWithKeys(keySet, c.AccessTokenTTL()), nil
+}
+
+// AccessTokenTTL returns the lifetime of access tokens
+func (c JWTConfig) AccessTokenTTL() time.Duration {
+	return time.Duration(c.AccessTokenMinutes) * time.Minute
+}
+
+// RefreshTokenTTL returns the lifetime of refresh tokens
+func (c JWTConfig) RefreshTokenTTL() time.Duration {
+	return time.Duration(c.DayExpired) * 24 * time.Hour
+}
+
+// Mailer builds the mailer. The "log" driver logs recipients and subjects
+// and writes the messages to output_dir, "smtp" sends them.
+func (c MailConfig) Mailer(log *logger.Logger) (mailer.Mailer, error) {
+	switch c.Driver {
+	case "log":
+		return mailer.NewLogMailer(log, c.OutputDir, c.From), nil
+	case "smtp":
+		return mailer.NewSMTPMailer(mailer.SMTPMailer{
+			Host:     c.SMTPHost,
+			Port:     c.SMTPPort,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword.Reveal(),
+			From:     c.From,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", c.Driver)
+	}
+}
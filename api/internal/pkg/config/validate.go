@@ -0,0 +1,161 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"nanonime/internal/pkg/jwt"
+	"nanonime/internal/pkg/logger"
+)
+
+// Validator collects every configuration error instead of stopping at the
+// first one. Modules use it to validate their [modules.<name>] section.
+type Validator struct {
+	prefix string
+	errs   []error
+}
+
+// NewValidator prefixes the keys of reported errors with prefix, e.g.
+// "modules.auth."
+func NewValidator(prefix string) *Validator {
+	return &Validator{prefix: prefix}
+}
+
+// Fail reports an invalid key
+func (v *Validator) Fail(key, format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf("%s%s: %s", v.prefix, key, fmt.Sprintf(format, args...)))
+}
+
+// Required reports an empty value
+func (v *Validator) Required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.Fail(key, "is required")
+	}
+}
+
+// OneOf reports a value missing from allowed
+func (v *Validator) OneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// Positive reports a value below 1
+func (v *Validator) Positive(key string, value int) {
+	if value <= 0 {
+		v.Fail(key, "must be greater than 0, got %d", value)
+	}
+}
+
+// NonNegative reports a negative value
+func (v *Validator) NonNegative(key string, value int) {
+	if value < 0 {
+		v.Fail(key, "must not be negative, got %d", value)
+	}
+}
+
+// Port reports a value that is not a port number
+func (v *Validator) Port(key, value string) {
+	if n, err := strconv.Atoi(value); err != nil || n <= 0 || n > 65535 {
+		v.Fail(key, "must be a port number, got %q", value)
+	}
+}
+
+// Err returns the reported errors joined, nil when there are none
+func (v *Validator) Err() error {
+	return errors.Join(v.errs...)
+}
+
+// Validate reports every invalid value of the configuration at once
+func (c *Config) Validate() error {
+	v := NewValidator("")
+
+	v.Required("server.app_name", c.Server.AppName)
+	v.Port("server.port", c.Server.Port)
+	v.Required("server.api_version", c.Server.APIVersion)
+	v.NonNegative("server.http_timeout", c.Server.HTTPTimeout)
+	v.NonNegative("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	v.NonNegative("server.cache_expired", c.Server.CacheExpired)
+	v.Positive("server.cache_purged", c.Server.CachePurged)
+	if c.Server.RateLimit < 0 {
+		v.Fail("server.rate_limit", "must not be negative, got %g", c.Server.RateLimit)
+	}
+	v.NonNegative("server.rate_burst", c.Server.RateBurst)
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			v.Fail("server.trusted_proxies", "%q is not an address or CIDR range", proxy)
+		}
+	}
+	if c.Server.TLSEnabled {
+		v.Required("server.tls_cert_file", c.Server.TLSCertFile)
+		v.Required("server.tls_key_file", c.Server.TLSKeyFile)
+		v.OneOf("server.tls_min_version", c.Server.TLSMinVersion, "1.2", "1.3")
+		if c.Server.TLSRedirectPort != "" {
+			v.Port("server.tls_redirect_port", c.Server.TLSRedirectPort)
+		}
+	}
+
+	v.OneOf("log.level", c.Log.Level, logger.DebugLevel, logger.InfoLevel, logger.WarnLevel, logger.ErrorLevel, logger.FatalLevel)
+
+	v.OneOf("database.db_driver", c.Database.Driver, "mysql", "postgres")
+	v.Required("database.db_host", c.Database.Host)
+	v.Port("database.db_port", c.Database.Port)
+	v.Required("database.db_name", c.Database.Name)
+	v.Required("database.db_username", c.Database.Username)
+	v.Positive("database.migrate_lock_timeout", c.Database.MigrateLockTimeout)
+
+	v.NonNegative("pool.conn_idle", c.Pool.ConnIdle)
+	v.NonNegative("pool.conn_max", c.Pool.ConnMax)
+	v.NonNegative("pool.conn_lifetime", c.Pool.ConnLifetime)
+
+	v.Positive("jwt.day_expired", c.JWT.DayExpired)
+	v.Positive("jwt.access_token_minutes", c.JWT.AccessTokenMinutes)
+	v.OneOf("jwt.algorithm", c.JWT.Algorithm, jwt.AlgorithmHS256, jwt.AlgorithmRS256, jwt.AlgorithmEdDSA)
+	if c.JWT.Algorithm == jwt.AlgorithmHS256 {
+		v.Required("jwt.signature_key", c.JWT.SignatureKey.Reveal())
+	} else if len(c.JWT.Keys) == 0 {
+		v.Fail("jwt.keys", "at least one key is required for %s", c.JWT.Algorithm)
+	}
+
+	v.Positive("bus.queue_size", c.Bus.QueueSize)
+	v.Positive("bus.workers", c.Bus.Workers)
+	v.NonNegative("bus.handler_timeout", c.Bus.HandlerTimeout)
+	v.NonNegative("bus.request_timeout", c.Bus.RequestTimeout)
+	v.OneOf("bus.transport", c.Bus.Transport, "memory", "nats")
+	if c.Bus.Transport == "nats" {
+		v.Required("bus.nats_url", c.Bus.NatsURL.Reveal())
+	}
+	v.OneOf("bus.mode", c.Bus.Mode, "memory", "outbox")
+	if c.Bus.Mode == "outbox" {
+		v.Positive("bus.outbox_poll_interval_ms", c.Bus.OutboxPollIntervalMs)
+		v.Positive("bus.outbox_batch_size", c.Bus.OutboxBatchSize)
+		v.Positive("bus.outbox_max_attempts", c.Bus.OutboxMaxAttempts)
+		v.Positive("bus.outbox_retry_backoff", c.Bus.OutboxRetryBackoff)
+		v.Positive("bus.outbox_max_retry_backoff", c.Bus.OutboxMaxRetryBackoff)
+		v.Positive("bus.outbox_claim_timeout", c.Bus.OutboxClaimTimeout)
+	}
+
+	v.OneOf("cache.driver", c.Cache.Driver, "memory", "redis")
+	if c.Cache.Driver == "redis" {
+		v.Required("cache.redis_url", c.Cache.RedisURL.Reveal())
+	}
+	v.NonNegative("cache.http_ttl_seconds", c.Cache.HTTPTTLSeconds)
+
+	v.OneOf("mail.driver", c.Mail.Driver, "log", "smtp")
+	v.Required("mail.from", c.Mail.From)
+	if c.Mail.Driver == "smtp" {
+		v.Required("mail.smtp_host", c.Mail.SMTPHost)
+		v.Port("mail.smtp_port", c.Mail.SMTPPort)
+	}
+
+	if err := v.Err(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
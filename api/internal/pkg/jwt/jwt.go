@@ -1,94 +1,134 @@
 package jwt
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	gojwt "github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Claims are the typed claims carried by an access token
+type Claims struct {
+	UserID    uint
+	Email     string
+	Name      string
+	Role      string
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
 type JWT interface {
-	GenerateToken(data map[string]interface{}) (string, error)
-	ValidateToken(token string) (bool, error)
-	ParseToken(tokenString string) (map[string]interface{}, error)
+	// GenerateToken signs claims. TokenID, IssuedAt and ExpiresAt are filled
+	// in when left empty.
+	GenerateToken(claims Claims) (string, error)
+
+	// ValidateToken verifies the signature and expiry of a token and returns
+	// its claims
+	ValidateToken(token string) (*Claims, error)
+
+	// JWKS returns the public keys other services can verify tokens with
+	JWKS() JWKS
+}
+
+// tokenClaims is the wire format of Claims
+type tokenClaims struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"`
+	Name   string `json:"name,omitempty"`
+	Role   string `json:"role,omitempty"`
+	gojwt.StandardClaims
 }
 
 type JWTImpl struct {
-	SignatureKey string
-	Expiration   int
+	Keys       *KeySet
+	Expiration time.Duration
 }
 
-func NewJWTImpl(signatureKey string, expiration int) JWT {
-	return &JWTImpl{SignatureKey: signatureKey, Expiration: expiration}
+// NewJWTImpl creates an HS256 signer with a single shared secret
+func NewJWTImpl(signatureKey string, expiration time.Duration) JWT {
+	keys, _ := NewKeySet("", NewHMACKey("", []byte(signatureKey)))
+	return &JWTImpl{Keys: keys, Expiration: expiration}
 }
 
-func (j *JWTImpl) GenerateToken(data map[string]interface{}) (string, error) {
-	var mySigningKey = []byte(j.SignatureKey)
-	token := gojwt.New(gojwt.SigningMethodHS256)
-	claims := token.Claims.(gojwt.MapClaims)
+// NewJWTWithKeys creates a signer using a key set, tokens carry the "kid" of
+// the key that signed them
+func NewJWTWithKeys(keys *KeySet, expiration time.Duration) JWT {
+	return &JWTImpl{Keys: keys, Expiration: expiration}
+}
 
-	for key, value := range data {
-		claims[key] = value
-	}
+func (j *JWTImpl) GenerateToken(claims Claims) (string, error) {
+	key := j.Keys.signing
 
 	/**
-	-jwt expires in day-
-	 for example, if j.Expiration is 20, then the token will expire in 20 days
+	-jwt expires after j.Expiration-
+	 access tokens are short lived, sessions are kept alive with refresh tokens
 	**/
-	expirationDuration := time.Duration(j.Expiration) * 24 * time.Hour * 7
-	expirationTime := time.Now().Add(expirationDuration).Unix()
-	claims["exp"] = expirationTime
-
-	tokenString, err := token.SignedString(mySigningKey)
-
-	if err != nil {
-		return "", err
+	if claims.IssuedAt.IsZero() {
+		claims.IssuedAt = time.Now()
+	}
+	if claims.ExpiresAt.IsZero() {
+		claims.ExpiresAt = claims.IssuedAt.Add(j.Expiration)
+	}
+	if claims.TokenID == "" {
+		claims.TokenID = uuid.NewString()
 	}
-	return tokenString, nil
-}
-
-func (j *JWTImpl) ValidateToken(tokenString string) (bool, error) {
-	token, err := gojwt.Parse(tokenString, func(token *gojwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*gojwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
 
-		return []byte(j.SignatureKey), nil
+	token := gojwt.NewWithClaims(key.method(), tokenClaims{
+		UserID: claims.UserID,
+		Email:  claims.Email,
+		Name:   claims.Name,
+		Role:   claims.Role,
+		StandardClaims: gojwt.StandardClaims{
+			Id:        claims.TokenID,
+			Subject:   fmt.Sprint(claims.UserID),
+			IssuedAt:  claims.IssuedAt.Unix(),
+			ExpiresAt: claims.ExpiresAt.Unix(),
+		},
 	})
-
-	if err != nil {
-		return false, err
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
 	}
 
-	claims, ok := token.Claims.(gojwt.MapClaims)
-	if !ok || !token.Valid {
-		return false, nil
-	}
+	tokenString, err := token.SignedString(key.signKey)
 
-	expirationTime := claims["exp"].(float64)
-	if time.Now().Unix() > int64(expirationTime) {
-		return false, nil
+	if err != nil {
+		return "", err
 	}
-
-	return true, nil
+	return tokenString, nil
 }
 
-func (j *JWTImpl) ParseToken(tokenString string) (map[string]interface{}, error) {
-	token, err := gojwt.Parse(tokenString, func(token *gojwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*gojwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(j.SignatureKey), nil
-	})
+func (j *JWTImpl) ValidateToken(tokenString string) (*Claims, error) {
+	parsed := &tokenClaims{}
+	token, err := gojwt.ParseWithClaims(tokenString, parsed, j.Keys.lookup)
 
 	if err != nil {
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(gojwt.MapClaims)
-	if !ok || !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+	// StandardClaims.Valid has already rejected expired tokens, but tokens
+	// without an expiry are never accepted
+	if !token.Valid || parsed.ExpiresAt == 0 {
+		return nil, ErrInvalidToken
 	}
 
-	return claims, nil
+	return &Claims{
+		UserID:    parsed.UserID,
+		Email:     parsed.Email,
+		Name:      parsed.Name,
+		Role:      parsed.Role,
+		TokenID:   parsed.Id,
+		IssuedAt:  time.Unix(parsed.IssuedAt, 0),
+		ExpiresAt: time.Unix(parsed.ExpiresAt, 0),
+	}, nil
+}
+
+func (j *JWTImpl) JWKS() JWKS {
+	return j.Keys.JWKS()
 }
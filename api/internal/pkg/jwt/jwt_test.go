@@ -0,0 +1,152 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt"
+)
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestHMACRoundTrip(t *testing.T) {
+	service := NewJWTImpl("secret", time.Minute)
+
+	token, err := service.GenerateToken(Claims{UserID: 7, Email: "a@example.com", Role: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := service.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != 7 || claims.Role != "admin" || claims.TokenID == "" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if len(service.JWKS().Keys) != 0 {
+		t.Error("shared secrets must not be published")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKey := rsaKey(t), rsaKey(t)
+
+	before, err := NewKeySet("2026-04", NewRSAKey("2026-04", oldKey, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := NewJWTWithKeys(before, time.Minute).GenerateToken(Claims{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The retired key only keeps its public part
+	after, err := NewKeySet("2026-10",
+		NewRSAKey("2026-10", newKey, nil),
+		NewRSAKey("2026-04", nil, &oldKey.PublicKey),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewJWTWithKeys(after, time.Minute)
+
+	if _, err := service.ValidateToken(oldToken); err != nil {
+		t.Fatalf("token signed with retired key rejected: %v", err)
+	}
+
+	newToken, _ := service.GenerateToken(Claims{UserID: 2})
+	parsed, _, _ := new(gojwt.Parser).ParseUnverified(newToken, &tokenClaims{})
+	if parsed.Header["kid"] != "2026-10" || parsed.Header["alg"] != "RS256" {
+		t.Errorf("unexpected header: %v", parsed.Header)
+	}
+
+	if jwks := service.JWKS(); len(jwks.Keys) != 2 || jwks.Keys[0].Kty != "RSA" {
+		t.Errorf("unexpected jwks: %+v", jwks)
+	}
+
+	unknown, _ := NewKeySet("other", NewRSAKey("other", rsaKey(t), nil))
+	otherToken, _ := NewJWTWithKeys(unknown, time.Minute).GenerateToken(Claims{UserID: 3})
+	if _, err := service.ValidateToken(otherToken); err == nil {
+		t.Error("token with unknown kid accepted")
+	}
+}
+
+func TestAlgorithmIsPinnedToKey(t *testing.T) {
+	key := rsaKey(t)
+	keys, _ := NewKeySet("rsa", NewRSAKey("rsa", key, nil))
+	service := NewJWTWithKeys(keys, time.Minute)
+
+	// Forge an HS256 token using the public key as the shared secret
+	publicDer, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	forged := gojwt.NewWithClaims(gojwt.SigningMethodHS256, tokenClaims{
+		UserID:         1,
+		StandardClaims: gojwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	})
+	forged.Header["kid"] = "rsa"
+	token, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}))
+
+	if _, err := service.ValidateToken(token); err == nil {
+		t.Error("token with mismatched algorithm accepted")
+	}
+}
+
+func TestLoadEdDSAKey(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	privateDer, _ := x509.MarshalPKCS8PrivateKey(private)
+	publicDer, _ := x509.MarshalPKIXPublicKey(public)
+	privateFile := filepath.Join(dir, "ed.pem")
+	publicFile := filepath.Join(dir, "ed.pub.pem")
+	os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer}), 0600)
+	os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}), 0600)
+
+	signer, err := LoadKey("ed", AlgorithmEdDSA, privateFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := LoadKey("ed", AlgorithmEdDSA, "", publicFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signKeys, _ := NewKeySet("ed", signer)
+	token, err := NewJWTWithKeys(signKeys, time.Minute).GenerateToken(Claims{UserID: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewKeySet("ed", verifier); err == nil {
+		t.Error("verification-only key accepted as signing key")
+	}
+
+	verifyKeys := &KeySet{keys: map[string]*Key{"ed": verifier}, signing: signer}
+	claims, err := NewJWTWithKeys(verifyKeys, time.Minute).ValidateToken(token)
+	if err != nil || claims.UserID != 9 {
+		t.Fatalf("unexpected result: %+v, %v", claims, err)
+	}
+
+	jwks := verifyKeys.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Crv != "Ed25519" {
+		t.Errorf("unexpected jwks: %+v", jwks)
+	}
+}
@@ -0,0 +1,224 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	gojwt "github.com/golang-jwt/jwt"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key is a signing or verification key identified by ID, sent as the "kid"
+// header of the tokens it signs. Keys without a private part can only verify,
+// which is how retired keys are kept around during rotation.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey creates a shared secret key
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: AlgorithmHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewRSAKey creates an RS256 key. private may be nil for verification-only keys.
+func NewRSAKey(id string, private *rsa.PrivateKey, public *rsa.PublicKey) *Key {
+	key := &Key{ID: id, Algorithm: AlgorithmRS256, verifyKey: public}
+	if private != nil {
+		key.signKey = private
+		key.verifyKey = &private.PublicKey
+	}
+	return key
+}
+
+// NewEdDSAKey creates an Ed25519 key. private may be nil for verification-only
+// keys.
+func NewEdDSAKey(id string, private ed25519.PrivateKey, public ed25519.PublicKey) *Key {
+	key := &Key{ID: id, Algorithm: AlgorithmEdDSA, verifyKey: public}
+	if private != nil {
+		key.signKey = private
+		key.verifyKey = private.Public().(ed25519.PublicKey)
+	}
+	return key
+}
+
+// LoadKey reads an asymmetric key from PEM files. Either file may be empty:
+// a key with only a public file verifies tokens but cannot sign them.
+func LoadKey(id, algorithm, privateKeyFile, publicKeyFile string) (*Key, error) {
+	if privateKeyFile == "" && publicKeyFile == "" {
+		return nil, fmt.Errorf("jwt key %s: no key file configured", id)
+	}
+
+	var privatePEM, publicPEM []byte
+	var err error
+	if privateKeyFile != "" {
+		if privatePEM, err = os.ReadFile(privateKeyFile); err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", id, err)
+		}
+	}
+	if publicKeyFile != "" {
+		if publicPEM, err = os.ReadFile(publicKeyFile); err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", id, err)
+		}
+	}
+
+	switch algorithm {
+	case AlgorithmRS256:
+		var private *rsa.PrivateKey
+		var public *rsa.PublicKey
+		if privatePEM != nil {
+			if private, err = gojwt.ParseRSAPrivateKeyFromPEM(privatePEM); err != nil {
+				return nil, fmt.Errorf("jwt key %s: %w", id, err)
+			}
+		} else if public, err = gojwt.ParseRSAPublicKeyFromPEM(publicPEM); err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", id, err)
+		}
+		return NewRSAKey(id, private, public), nil
+	case AlgorithmEdDSA:
+		var private ed25519.PrivateKey
+		var public ed25519.PublicKey
+		if privatePEM != nil {
+			parsed, err := gojwt.ParseEdPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, fmt.Errorf("jwt key %s: %w", id, err)
+			}
+			private = parsed.(ed25519.PrivateKey)
+		} else {
+			parsed, err := gojwt.ParseEdPublicKeyFromPEM(publicPEM)
+			if err != nil {
+				return nil, fmt.Errorf("jwt key %s: %w", id, err)
+			}
+			public = parsed.(ed25519.PublicKey)
+		}
+		return NewEdDSAKey(id, private, public), nil
+	default:
+		return nil, fmt.Errorf("jwt key %s: unsupported algorithm %q", id, algorithm)
+	}
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+func (k *Key) method() gojwt.SigningMethod {
+	return gojwt.GetSigningMethod(k.Algorithm)
+}
+
+// KeySet holds every key accepted for verification and the key used to sign
+// new tokens
+type KeySet struct {
+	keys    map[string]*Key
+	signing *Key
+	legacy  *Key
+}
+
+// NewKeySet creates a key set signing with the key identified by signingID
+func NewKeySet(signingID string, keys ...*Key) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, exists := set.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate jwt key id %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	signing, ok := set.keys[signingID]
+	if !ok {
+		return nil, fmt.Errorf("jwt signing key %q not found", signingID)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("jwt signing key %q has no private key", signingID)
+	}
+	set.signing = signing
+
+	return set, nil
+}
+
+// SetLegacyKey sets the key used for tokens without a "kid" header, such as
+// HS256 tokens issued before switching to asymmetric keys
+func (s *KeySet) SetLegacyKey(key *Key) {
+	s.legacy = key
+}
+
+// lookup resolves the verification key of a token
+func (s *KeySet) lookup(token *gojwt.Token) (interface{}, error) {
+	var key *Key
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok = s.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	} else if s.legacy != nil {
+		key = s.legacy
+	} else {
+		key = s.signing
+	}
+
+	// The algorithm is pinned to the key so a token cannot pick how it is
+	// verified, e.g. HS256 with an RSA public key as secret
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. Shared secrets are never exposed.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Algorithm,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Algorithm,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
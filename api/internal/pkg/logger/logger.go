@@ -23,18 +23,19 @@ type Logger struct {
 	zap    *zap.Logger
 	sugar  *zap.SugaredLogger
 	prefix string
-	level  zapcore.Level
+	// level is shared with the loggers derived by WithPrefix
+	level zap.AtomicLevel
 }
 
 // Config holds the logger configuration
 type Config struct {
-	Level      string `json:"level"`
-	Encoding   string `json:"encoding"`
-	OutputPath string `json:"output_path"`
-	MaxSize    int    `json:"max_size"`    // Maximum size in megabytes before log file rotates
-	MaxBackups int    `json:"max_backups"` // Maximum number of old log files to retain
-	MaxAge     int    `json:"max_age"`     // Maximum number of days to retain old log files
-	Compress   bool   `json:"compress"`    // Whether to compress old log files
+	Level      string `json:"level" mapstructure:"level"`
+	Encoding   string `json:"encoding" mapstructure:"encoding"`
+	OutputPath string `json:"output_path" mapstructure:"output_path"`
+	MaxSize    int    `json:"max_size" mapstructure:"max_size"`       // Maximum size in megabytes before log file rotates
+	MaxBackups int    `json:"max_backups" mapstructure:"max_backups"` // Maximum number of old log files to retain
+	MaxAge     int    `json:"max_age" mapstructure:"max_age"`         // Maximum number of days to retain old log files
+	Compress   bool   `json:"compress" mapstructure:"compress"`       // Whether to compress old log files
 }
 
 // DefaultConfig returns the default configuration
@@ -102,7 +103,7 @@ func NewLogger(config Config, prefix string) (*Logger, error) {
 	}
 
 	// Determine the level
-	level := stringToZapLevel(config.Level)
+	level := zap.NewAtomicLevelAt(stringToZapLevel(config.Level))
 
 	// Create the core
 	var core zapcore.Core
@@ -152,6 +153,17 @@ func (l *Logger) WithPrefix(prefix string) *Logger {
 	}
 }
 
+// SetLevel changes the level of the logger and of every logger sharing its
+// root, e.g. to turn on debug logs without a restart
+func (l *Logger) SetLevel(level string) {
+	l.level.SetLevel(stringToZapLevel(level))
+}
+
+// Level returns the current level
+func (l *Logger) Level() string {
+	return l.level.Level().String()
+}
+
 // Debug logs a debug message
 func (l *Logger) Debug(msg string, fields ...interface{}) {
 	l.sugar.Debugw(msg, fields...)
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"nanonime/internal/pkg/logger"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogMailer logs messages instead of sending them. The body carries links
+// with live tokens, so it is only logged at debug level. When Dir is set
+// every message is also written there as an .eml file, which is handy for
+// local development and tests.
+type LogMailer struct {
+	Logger *logger.Logger
+	Dir    string
+	From   string
+}
+
+// NewLogMailer creates a new log mailer
+func NewLogMailer(log *logger.Logger, dir, from string) Mailer {
+	return &LogMailer{Logger: log, Dir: dir, From: from}
+}
+
+// Send implements Mailer
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	body, err := build(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	if m.Logger != nil {
+		m.Logger.Info("Mail sent", "to", msg.To, "subject", msg.Subject)
+		m.Logger.Debug("Mail body", "to", msg.To, "body", msg.Text)
+	}
+
+	if m.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	return os.WriteFile(filepath.Join(m.Dir, name), body, 0600)
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := NewLogMailer(nil, dir, "NanoNime <no-reply@example.com>")
+
+	err := m.Send(context.Background(), Message{
+		To:      []string{"user@example.com"},
+		Subject: "Verify\r\nBcc: attacker@example.com",
+		Text:    "Open the link",
+		HTML:    "<p>Open the link</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("expected one message, got %d", len(files))
+	}
+	raw, _ := os.ReadFile(dir + "/" + files[0].Name())
+	content := string(raw)
+
+	if strings.Contains(content, "\r\nBcc:") {
+		t.Error("header injection was not prevented")
+	}
+	for _, want := range []string{"To: user@example.com", "multipart/alternative", "<p>Open the link</p>"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("message does not contain %q", want)
+		}
+	}
+}
+
+func TestSendWithoutRecipients(t *testing.T) {
+	if err := NewLogMailer(nil, "", "").Send(context.Background(), Message{Subject: "x"}); err == nil {
+		t.Error("expected an error for a message without recipients")
+	}
+}
@@ -1,20 +1,53 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"nanonime/internal/pkg/jwt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo"
 )
 
+// PrincipalKey is the echo.Context key holding the authenticated *Principal
+const PrincipalKey = "user"
+
 var jwtService jwt.JWT
 
+// TokenDenylist holds the ids of access tokens revoked before they expire
+type TokenDenylist interface {
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+var denylist TokenDenylist
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID   uint
+	Email    string
+	Name     string
+	Role     string
+	TokenID  string
+	IssuedAt time.Time
+}
+
 func InitializeAuth(service jwt.JWT) {
 	jwtService = service
 }
 
+// UseTokenDenylist makes Auth reject the access tokens revoked in list
+func UseTokenDenylist(list TokenDenylist) {
+	denylist = list
+}
+
+// GetPrincipal returns the authenticated caller placed in the context by Auth
+func GetPrincipal(c echo.Context) (*Principal, bool) {
+	principal, ok := c.Get(PrincipalKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
 func Auth(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		authHeader := c.Request().Header.Get("Authorization")
@@ -42,7 +75,30 @@ func Auth(next echo.HandlerFunc) echo.HandlerFunc {
 			})
 		}
 
-		c.Set("user", claims)
+		if denylist != nil {
+			revoked, err := denylist.IsRevoked(c.Request().Context(), claims.TokenID)
+			if err != nil {
+				return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+					"error":   fmt.Sprintf("Unable to check token: %v", err),
+					"message": "Service Unavailable",
+				})
+			}
+			if revoked {
+				return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+					"error":   "Token has been revoked",
+					"message": "Unauthorized",
+				})
+			}
+		}
+
+		c.Set(PrincipalKey, &Principal{
+			UserID:   claims.UserID,
+			Email:    claims.Email,
+			Name:     claims.Name,
+			Role:     claims.Role,
+			TokenID:  claims.TokenID,
+			IssuedAt: claims.IssuedAt,
+		})
 
 		return next(c)
 	}
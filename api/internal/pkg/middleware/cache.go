@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"nanonime/internal/pkg/cache"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// cacheNamespace prefixes the keys of cached responses and their tags
+	cacheNamespace     = "http"
+	headerCacheControl = "Cache-Control"
+)
+
+var (
+	responseCache *cache.Cache[cachedResponse]
+	responseTags  *cache.Tags
+	// responseTTL is the default ttl in nanoseconds, see SetCacheTTL
+	responseTTL atomic.Int64
+)
+
+// cachedResponse is a response stored by Cache
+type cachedResponse struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+	Body        []byte `json:"body"`
+}
+
+// CacheOptions configures the caching of a route
+type CacheOptions struct {
+	// TTL is how long responses are cached, zero uses the default
+	TTL time.Duration
+	// Tags group the responses for PurgeCache. "{name}" is replaced with
+	// the route parameter name, e.g. "user:{id}".
+	Tags []string
+	// PerUser caches responses per authenticated user, it must run after
+	// Auth. Requests without a principal are not cached.
+	PerUser bool
+}
+
+// InitializeCache lets Cache store responses in store, for ttl unless the
+// route sets its own. Until it is called Cache passes requests through.
+func InitializeCache(store cache.Store, ttl time.Duration) {
+	responseCache = cache.New[cachedResponse](store, cache.Config{Namespace: cacheNamespace, TTL: ttl})
+	responseTags = cache.NewTags(store, cacheNamespace)
+	responseTTL.Store(int64(ttl))
+}
+
+// SetCacheTTL changes how long responses of routes without their own TTL are
+// cached, responses already cached keep their expiry
+func SetCacheTTL(ttl time.Duration) {
+	responseTTL.Store(int64(ttl))
+}
+
+// PurgeCache drops the cached responses of routes tagged with tags
+func PurgeCache(ctx context.Context, tags ...string) error {
+	if responseTags == nil {
+		return nil
+	}
+	return responseTags.Purge(ctx, tags...)
+}
+
+// Cache caches successful GET responses keyed on path and query, and the
+// user with PerUser. It must run after the route's authorization checks. Responses carry an ETag and Cache-Control, and requests
+// whose If-None-Match matches the ETag are answered with 304. The cache is
+// best effort, store failures are logged and the request is handled normally.
+func Cache(opts CacheOptions) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if responseCache == nil || c.Request().Method != http.MethodGet {
+				return next(c)
+			}
+
+			key, ok := cacheKey(c, opts)
+			if !ok {
+				return next(c)
+			}
+
+			ttl := opts.TTL
+			if ttl <= 0 {
+				ttl = time.Duration(responseTTL.Load())
+			}
+			// Shared caches must not keep responses to authenticated requests
+			cacheControl := "public"
+			if opts.PerUser || c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+				cacheControl = "private"
+			}
+			if opts.PerUser {
+				c.Response().Header().Add(echo.HeaderVary, echo.HeaderAuthorization)
+			}
+			if ttl > 0 {
+				cacheControl += ", max-age=" + strconv.Itoa(int(ttl/time.Second))
+			}
+
+			ctx := c.Request().Context()
+			version, err := responseTags.Version(ctx, cacheTags(c, opts.Tags)...)
+			if err != nil {
+				c.Logger().Warnf("response cache unavailable: %v", err)
+				return next(c)
+			}
+			key += "|" + version
+
+			cached, found, err := responseCache.Get(ctx, key)
+			if err != nil {
+				c.Logger().Warnf("response cache unavailable: %v", err)
+			}
+			if found {
+				header := c.Response().Header()
+				header.Set("ETag", cached.ETag)
+				header.Set(headerCacheControl, cacheControl)
+				header.Set("X-Cache", "HIT")
+				if etagMatches(c.Request().Header.Get("If-None-Match"), cached.ETag) {
+					return c.NoContent(http.StatusNotModified)
+				}
+				return c.Blob(http.StatusOK, cached.ContentType, cached.Body)
+			}
+
+			// Buffer the response so the ETag can be set before it is sent
+			res := c.Response()
+			writer := res.Writer
+			buffer := &bufferedWriter{ResponseWriter: writer, status: http.StatusOK}
+			res.Writer = buffer
+			err = next(c)
+			res.Writer = writer
+
+			if err != nil || buffer.status != http.StatusOK {
+				if buffer.written {
+					if flushErr := buffer.flush(); err == nil {
+						err = flushErr
+					}
+				}
+				return err
+			}
+
+			sum := sha256.Sum256(buffer.body.Bytes())
+			cached = cachedResponse{
+				ContentType: writer.Header().Get(echo.HeaderContentType),
+				ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+				Body:        buffer.body.Bytes(),
+			}
+			if err := responseCache.Set(ctx, key, cached, ttl); err != nil {
+				c.Logger().Warnf("response cache unavailable: %v", err)
+			}
+
+			header := writer.Header()
+			header.Set("ETag", cached.ETag)
+			header.Set(headerCacheControl, cacheControl)
+			header.Set("X-Cache", "MISS")
+			if etagMatches(c.Request().Header.Get("If-None-Match"), cached.ETag) {
+				header.Del(echo.HeaderContentType)
+				header.Del(echo.HeaderContentLength)
+				res.Status = http.StatusNotModified
+				res.Size = 0
+				writer.WriteHeader(http.StatusNotModified)
+				return nil
+			}
+			return buffer.flush()
+		}
+	}
+}
+
+// cacheKey returns the key of the request, false when it must not be cached
+func cacheKey(c echo.Context, opts CacheOptions) (string, bool) {
+	req := c.Request()
+	key := req.URL.Path + "?" + req.URL.Query().Encode()
+
+	if opts.PerUser {
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			return "", false
+		}
+		key += "|user:" + strconv.FormatUint(uint64(principal.UserID), 10)
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// cacheTags resolves the route parameters in tags
+func cacheTags(c echo.Context, tags []string) []string {
+	resolved := make([]string, len(tags))
+	for i, tag := range tags {
+		for _, name := range c.ParamNames() {
+			tag = strings.ReplaceAll(tag, "{"+name+"}", c.Param(name))
+		}
+		resolved[i] = tag
+	}
+	return resolved
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds back a response until flush
+type bufferedWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	w.status = status
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.body.Write(b)
+}
+
+// flush sends the buffered response
+func (w *bufferedWriter) flush() error {
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	return err
+}
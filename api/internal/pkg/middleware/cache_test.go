@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"nanonime/internal/pkg/cache"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+func TestCache(t *testing.T) {
+	InitializeCache(cache.NewMemoryStore(time.Minute), time.Minute)
+	defer func() { responseCache, responseTags = nil, nil }()
+
+	calls := 0
+	e := echo.New()
+	e.GET("/items/:id", func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusOK, map[string]string{"id": c.Param("id")})
+	}, Cache(CacheOptions{TTL: 30 * time.Second, Tags: []string{"item:{id}"}}))
+
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/items/1?b=2&a=1", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("Expected a cached 200 with an ETag, got %d %v", first.Code, first.Header())
+	}
+	if cc := first.Header().Get("Cache-Control"); cc != "public, max-age=30" {
+		t.Errorf("Unexpected Cache-Control %q", cc)
+	}
+
+	// Same query in another order is a hit
+	second := get("/items/1?a=1&b=2", "")
+	if second.Header().Get("X-Cache") != "HIT" || second.Body.String() != first.Body.String() || calls != 1 {
+		t.Errorf("Expected a cache hit, got %v after %d calls", second.Header(), calls)
+	}
+
+	if rec := get("/items/1?a=1&b=2", etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected 304 for a matching If-None-Match, got %d", rec.Code)
+	}
+
+	if err := PurgeCache(context.Background(), "item:2"); err != nil {
+		t.Fatal(err)
+	}
+	if get("/items/1?a=1&b=2", "").Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Purging another tag must keep the response")
+	}
+
+	if err := PurgeCache(context.Background(), "item:1"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get("/items/1?a=1&b=2", etag); rec.Code != http.StatusNotModified || rec.Header().Get("X-Cache") != "MISS" || calls != 2 {
+		t.Errorf("Expected a revalidated miss after purge, got %d %v after %d calls", rec.Code, rec.Header(), calls)
+	}
+}
+
+func TestCachePerUser(t *testing.T) {
+	InitializeCache(cache.NewMemoryStore(time.Minute), time.Minute)
+	defer func() { responseCache, responseTags = nil, nil }()
+
+	e := echo.New()
+	e.GET("/me", func(c echo.Context) error {
+		principal, _ := GetPrincipal(c)
+		return c.String(http.StatusOK, principal.Email)
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			email := c.Request().Header.Get("X-Email")
+			c.Set(PrincipalKey, &Principal{UserID: uint(len(email)), Email: email})
+			return next(c)
+		}
+	}, Cache(CacheOptions{PerUser: true}))
+
+	get := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("X-Email", email)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	get("a@example.com")
+	if rec := get("bb@example.com"); rec.Body.String() != "bb@example.com" || rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected users to be cached separately, got %q", rec.Body.String())
+	}
+	if rec := get("a@example.com"); rec.Header().Get("Cache-Control") != "private, max-age=60" || rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected a private hit, got %v", rec.Header())
+	}
+}
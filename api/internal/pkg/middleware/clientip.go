@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/labstack/echo"
+)
+
+// trustedProxies are the networks whose forwarding headers are believed
+var trustedProxies atomic.Pointer[[]*net.IPNet]
+
+// SetTrustedProxies sets the addresses or CIDR ranges, e.g. "10.0.0.0/8", of
+// the reverse proxies in front of the API. Forwarding headers of other peers
+// are ignored, so clients cannot pick the address they are limited by.
+func SetTrustedProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		network, err := ParseProxy(proxy)
+		if err != nil {
+			return err
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies.Store(&networks)
+	return nil
+}
+
+// ParseProxy parses an address or CIDR range of a trusted proxy
+func ParseProxy(proxy string) (*net.IPNet, error) {
+	if !strings.Contains(proxy, "/") {
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid proxy address %q", proxy)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy range %q", proxy)
+	}
+	return network, nil
+}
+
+// ClientIP returns the address of the client of c. It is the peer address of
+// the connection unless the peer is a trusted proxy, in which case it is the
+// last address of X-Forwarded-For not belonging to a trusted proxy, or
+// X-Real-IP.
+func ClientIP(c echo.Context) string {
+	req := c.Request()
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	if forwarded := req.Header.Get(echo.HeaderXForwardedFor); forwarded != "" {
+		// Walk back from the hop closest to us, the first hop that is not a
+		// trusted proxy is the client
+		client := peer
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			client = hop
+			if !isTrustedProxy(hop) {
+				break
+			}
+		}
+		return client
+	}
+	if realIP := strings.TrimSpace(req.Header.Get(echo.HeaderXRealIP)); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return peer
+}
+
+func isTrustedProxy(addr string) bool {
+	networks := trustedProxies.Load()
+	if networks == nil {
+		return false
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range *networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
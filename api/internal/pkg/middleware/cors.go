@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"sync/atomic"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+)
+
+// CORS answers cross-origin requests for a list of allowed origins that can
+// be changed while serving with SetOrigins
+type CORS struct {
+	middleware atomic.Pointer[echo.MiddlewareFunc]
+}
+
+// NewCORS allows origins, "*" or an empty list allows every origin
+func NewCORS(origins []string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(origins)
+	return c
+}
+
+// SetOrigins replaces the allowed origins
+func (c *CORS) SetOrigins(origins []string) {
+	mw := middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: append([]string(nil), origins...),
+	})
+	c.middleware.Store(&mw)
+}
+
+// Middleware applies the current origins to every request
+func (c *CORS) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			return (*c.middleware.Load())(next)(ctx)
+		}
+	}
+}
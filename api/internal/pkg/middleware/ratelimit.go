@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"golang.org/x/time/rate"
+)
+
+// idleClient is how long the limiter of a client without requests is kept
+const idleClient = 10 * time.Minute
+
+// maxClients bounds the number of client limiters kept in memory
+const maxClients = 10000
+
+// RateLimiter limits the requests of every client IP, as returned by
+// ClientIP, with a token bucket. Limits can be changed while serving with
+// SetLimit.
+type RateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*rateClient
+	lastSweep time.Time
+}
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter allows every client perSecond requests with bursts of
+// burst requests, a perSecond of zero disables the limit
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	r := &RateLimiter{clients: make(map[string]*rateClient), lastSweep: time.Now()}
+	r.SetLimit(perSecond, burst)
+	return r
+}
+
+// SetLimit changes the limit of every client
+func (r *RateLimiter) SetLimit(perSecond float64, burst int) {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limit = rate.Limit(perSecond)
+	r.burst = burst
+	for _, client := range r.clients {
+		client.limiter.SetLimit(r.limit)
+		client.limiter.SetBurst(r.burst)
+	}
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests
+func (r *RateLimiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !r.allow(ClientIP(c), time.Now()) {
+				c.Response().Header().Set("Retry-After", "1")
+				return c.JSON(http.StatusTooManyRequests, map[string]interface{}{
+					"error":   "Rate limit exceeded",
+					"message": "Too Many Requests",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+func (r *RateLimiter) allow(key string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.limit <= 0 {
+		return true
+	}
+
+	if now.Sub(r.lastSweep) > idleClient {
+		for k, client := range r.clients {
+			if now.Sub(client.lastSeen) > idleClient {
+				delete(r.clients, k)
+			}
+		}
+		r.lastSweep = now
+	}
+
+	client, ok := r.clients[key]
+	if !ok {
+		if len(r.clients) >= maxClients {
+			r.evict(now)
+		}
+		client = &rateClient{limiter: rate.NewLimiter(r.limit, r.burst)}
+		r.clients[key] = client
+	}
+	client.lastSeen = now
+	return client.limiter.AllowN(now, 1)
+}
+
+// evict makes room for a new client. Clients whose bucket is full again are
+// forgotten first, a new limiter would be identical; when every client is
+// being limited an arbitrary one is dropped.
+func (r *RateLimiter) evict(now time.Time) {
+	for k, client := range r.clients {
+		if client.limiter.TokensAt(now) >= float64(r.burst) {
+			delete(r.clients, k)
+		}
+	}
+	if len(r.clients) < maxClients {
+		return
+	}
+	for k := range r.clients {
+		delete(r.clients, k)
+		return
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(1, 2)
+	now := time.Now()
+
+	if !limiter.allow("a", now) || !limiter.allow("a", now) {
+		t.Fatal("Expected the burst to be allowed")
+	}
+	if limiter.allow("a", now) {
+		t.Error("Expected the third request to be limited")
+	}
+	if !limiter.allow("b", now) {
+		t.Error("Expected clients to be limited separately")
+	}
+	if !limiter.allow("a", now.Add(time.Second)) {
+		t.Error("Expected a token after a second")
+	}
+
+	limiter.SetLimit(0, 0)
+	for i := 0; i < 10; i++ {
+		if !limiter.allow("a", now) {
+			t.Fatal("Expected no limit once disabled")
+		}
+	}
+}
+
+func TestRateLimiterCapsClients(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	now := time.Now()
+
+	for i := 0; i < maxClients+100; i++ {
+		limiter.allow(strconv.Itoa(i), now)
+	}
+	if len(limiter.clients) > maxClients {
+		t.Fatalf("Expected at most %d clients, got %d", maxClients, len(limiter.clients))
+	}
+
+	// Clients whose bucket refilled are forgotten first
+	limiter.allow("new", now.Add(time.Second))
+	if len(limiter.clients) != 1 {
+		t.Errorf("Expected refilled clients to be evicted, got %d", len(limiter.clients))
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"nanonime/internal/pkg/rbac"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// RequireRole only lets callers with one of roles through. It must run after
+// Auth.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := GetPrincipal(c)
+			if !ok {
+				return unauthorized(c)
+			}
+
+			for _, role := range roles {
+				if principal.Role == role {
+					return next(c)
+				}
+			}
+			return forbidden(c)
+		}
+	}
+}
+
+// RequirePermission only lets callers whose role is granted every permission
+// in rbac.Default through. It must run after Auth.
+func RequirePermission(permissions ...rbac.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := GetPrincipal(c)
+			if !ok {
+				return unauthorized(c)
+			}
+
+			for _, permission := range permissions {
+				if !rbac.Default.Can(principal.Role, permission) {
+					return forbidden(c)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+func unauthorized(c echo.Context) error {
+	return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+		"error":   "Authentication required",
+		"message": "Unauthorized",
+	})
+}
+
+func forbidden(c echo.Context) error {
+	return c.JSON(http.StatusForbidden, map[string]interface{}{
+		"error":   "You do not have permission to access this resource",
+		"message": "Forbidden",
+	})
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"nanonime/internal/pkg/trace"
+
+	"github.com/labstack/echo"
+)
+
+// Trace continues the trace of an incoming traceparent header, or starts a
+// new one, and places a span for the request into the request context. The
+// span is echoed in the response so clients can quote it.
+func Trace(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+
+		sc, err := trace.Parse(req.Header.Get(trace.Header))
+		if err != nil {
+			sc = trace.New()
+		} else {
+			sc = sc.Child()
+		}
+
+		c.SetRequest(req.WithContext(trace.NewContext(req.Context(), sc)))
+		c.Response().Header().Set(trace.Header, sc.Traceparent())
+
+		return next(c)
+	}
+}
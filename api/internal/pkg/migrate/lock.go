@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// lockPollInterval is how often a Postgres lock held by another replica is
+// tried again
+const lockPollInterval = 500 * time.Millisecond
+
+// lock takes a database-wide lock so concurrent replicas do not apply the
+// same migrations: GET_LOCK on MySQL, an advisory lock on Postgres. Both are
+// held by a session, so a connection is reserved until the lock is released.
+// Other databases, e.g. SQLite in tests, are not locked.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	driver := m.db.Dialector.Name()
+	if driver != "mysql" && driver != "postgres" {
+		return func() {}, nil
+	}
+
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var release func() error
+	if driver == "mysql" {
+		release, err = lockMySQL(ctx, conn, m.opts.LockName, m.opts.LockTimeout)
+	} else {
+		release, err = lockPostgres(ctx, conn, m.opts.LockName, m.opts.LockTimeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("lock migrations: %w", err)
+	}
+
+	return func() {
+		if err := release(); err != nil && m.logger != nil {
+			m.logger.Error("Failed to release the migration lock", "error", err)
+		}
+		conn.Close()
+	}, nil
+}
+
+func lockMySQL(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) (func() error, error) {
+	var acquired sql.NullInt64
+	err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(timeout.Seconds())).Scan(&acquired)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return nil, fmt.Errorf("timed out after %s waiting for lock %q", timeout, name)
+	}
+	return func() error {
+		_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+		return err
+	}, nil
+}
+
+func lockPostgres(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) (func() error, error) {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	id := int64(h.Sum64())
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", id).Scan(&acquired); err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for lock %q", timeout, name)
+		}
+
+		select {
+		case <-time.After(lockPollInterval):
+		case <-ctx.Done():
+			return nil, errors.Join(ctx.Err(), fmt.Errorf("waiting for lock %q", name))
+		}
+	}
+
+	return func() error {
+		_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", id)
+		return err
+	}, nil
+}
@@ -0,0 +1,312 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"nanonime/internal/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a versioned schema change of a module. Versions order the
+// migrations of a module and must be unique within it, e.g. 1, 2, 3 or a
+// date such as 20250317.
+type Migration struct {
+	Version int64
+	Name    string
+	// Up applies the change. It runs in a transaction together with its
+	// record in schema_migrations; MySQL commits DDL statements implicitly.
+	Up func(tx *gorm.DB) error
+	// Down reverts Up, nil when the migration cannot be reverted
+	Down func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement"`
+	Module    string    `gorm:"size:100;not null;uniqueIndex:idx_schema_migrations_version"`
+	Version   int64     `gorm:"not null;uniqueIndex:idx_schema_migrations_version"`
+	Name      string    `gorm:"size:255"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName stores the history in schema_migrations
+func (*SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status is a migration and when it was applied
+type Status struct {
+	Module  string
+	Version int64
+	Name    string
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time
+	// Missing marks an applied migration no longer declared by its module
+	Missing bool
+}
+
+// Options configures a Migrator
+type Options struct {
+	// LockName identifies the lock serializing migrations between replicas,
+	// it should name the database
+	LockName string
+	// LockTimeout is how long to wait for another replica's migrations
+	LockTimeout time.Duration
+}
+
+type source struct {
+	module     string
+	migrations []Migration
+}
+
+// Migrator applies the migrations of every module in registration order
+type Migrator struct {
+	db      *gorm.DB
+	logger  *logger.Logger
+	opts    Options
+	sources []source
+}
+
+// New creates a migrator for db
+func New(db *gorm.DB, log *logger.Logger, opts Options) *Migrator {
+	if opts.LockName == "" {
+		opts.LockName = "schema_migrations"
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = time.Minute
+	}
+	return &Migrator{db: db, logger: log, opts: opts}
+}
+
+// Register adds the migrations of module. Modules are migrated in the order
+// they are registered, so modules must be registered after the modules
+// they depend on.
+func (m *Migrator) Register(module string, migrations ...Migration) error {
+	for _, s := range m.sources {
+		if s.module == module {
+			return fmt.Errorf("migrations of module %s registered more than once", module)
+		}
+	}
+
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, migration := range sorted {
+		if migration.Version <= 0 {
+			return fmt.Errorf("migration %s of module %s: version must be positive", migration.Name, module)
+		}
+		if migration.Up == nil {
+			return fmt.Errorf("migration %d of module %s has no Up", migration.Version, module)
+		}
+		if i > 0 && sorted[i-1].Version == migration.Version {
+			return fmt.Errorf("module %s declares migration %d twice", module, migration.Version)
+		}
+	}
+
+	m.sources = append(m.sources, source{module: module, migrations: sorted})
+	return nil
+}
+
+// Up applies every pending migration and returns how many were applied. It
+// stops at the first failure.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, s := range m.sources {
+		for _, migration := range s.migrations {
+			if _, done := applied[key{s.module, migration.Version}]; done {
+				continue
+			}
+			if err := m.apply(ctx, s.module, migration); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Down reverts the steps most recently applied migrations, of module only
+// when it is not empty, and returns how many were reverted
+func (m *Migrator) Down(ctx context.Context, module string, steps int) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+
+	query := m.db.WithContext(ctx).Order("id DESC").Limit(steps)
+	if module != "" {
+		query = query.Where("module = ?", module)
+	}
+	var records []SchemaMigration
+	if err := query.Find(&records).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, record := range records {
+		migration, ok := m.find(record.Module, record.Version)
+		if !ok {
+			return count, fmt.Errorf("migration %d of module %s is applied but no longer declared", record.Version, record.Module)
+		}
+		if migration.Down == nil {
+			return count, fmt.Errorf("migration %d_%s of module %s cannot be reverted", migration.Version, migration.Name, record.Module)
+		}
+		if err := m.revert(ctx, record, migration); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status lists the declared migrations in the order they apply, followed by
+// applied migrations no longer declared
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, s := range m.sources {
+		for _, migration := range s.migrations {
+			status := Status{Module: s.module, Version: migration.Version, Name: migration.Name}
+			if record, ok := applied[key{s.module, migration.Version}]; ok {
+				status.AppliedAt = &record.AppliedAt
+				delete(applied, key{s.module, migration.Version})
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	missing := make([]Status, 0, len(applied))
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		missing = append(missing, Status{Module: record.Module, Version: record.Version, Name: record.Name, AppliedAt: &appliedAt, Missing: true})
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if missing[i].Module != missing[j].Module {
+			return missing[i].Module < missing[j].Module
+		}
+		return missing[i].Version < missing[j].Version
+	})
+	return append(statuses, missing...), nil
+}
+
+type key struct {
+	module  string
+	version int64
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	return m.db.WithContext(ctx).AutoMigrate(&SchemaMigration{})
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[key]SchemaMigration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := m.db.WithContext(ctx).Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[key]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[key{record.Module, record.Version}] = record
+	}
+	return applied, nil
+}
+
+func (m *Migrator) find(module string, version int64) (Migration, bool) {
+	for _, s := range m.sources {
+		if s.module != module {
+			continue
+		}
+		for _, migration := range s.migrations {
+			if migration.Version == version {
+				return migration, true
+			}
+		}
+	}
+	return Migration{}, false
+}
+
+func (m *Migrator) apply(ctx context.Context, module string, migration Migration) error {
+	started := time.Now()
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := migration.Up(tx); err != nil {
+			return err
+		}
+		return tx.Create(&SchemaMigration{
+			Module:    module,
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now().UTC(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s of module %s: %w", migration.Version, migration.Name, module, err)
+	}
+	m.log("Applied migration", "module", module, "version", migration.Version, "name", migration.Name, "duration", time.Since(started))
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, record SchemaMigration, migration Migration) error {
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := migration.Down(tx); err != nil {
+			return err
+		}
+		return tx.Delete(&SchemaMigration{}, record.ID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("revert migration %d_%s of module %s: %w", migration.Version, migration.Name, record.Module, err)
+	}
+	m.log("Reverted migration", "module", record.Module, "version", migration.Version, "name", migration.Name)
+	return nil
+}
+
+func (m *Migrator) log(msg string, fields ...interface{}) {
+	if m.logger != nil {
+		m.logger.Info(msg, fields...)
+	}
+}
+
+// AutoMigrate returns an Up creating the tables of models, or adding their
+// missing columns and indexes. It suits a module's first migration, which
+// then also adopts tables created before migrations were versioned.
+func AutoMigrate(models ...interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.AutoMigrate(models...)
+	}
+}
+
+// DropTables returns a Down dropping the tables of models, in reverse order
+func DropTables(models ...interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for i := len(models) - 1; i >= 0; i-- {
+			if err := tx.Migrator().DropTable(models[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,137 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+type Anime struct {
+	ID    uint
+	Title string
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	scripts, err := FromFS(fstest.MapFS{
+		"sql/1_create_genres.up.sql":     {Data: []byte("-- genres\nCREATE TABLE genres (\n  id INTEGER PRIMARY KEY\n);\nCREATE INDEX idx_genres ON genres (id);\n")},
+		"sql/1_create_genres.down.sql":   {Data: []byte("DROP TABLE genres;")},
+		"sql/2_add_name.up.sql":          {Data: []byte("ALTER TABLE genres ADD COLUMN label TEXT;")},
+		"sql/2_add_name.up.postgres.sql": {Data: []byte("ALTER TABLE genres ADD COLUMN label VARCHAR(100);")},
+		"sql/2_add_name.down.sql":        {Data: []byte("ALTER TABLE genres DROP COLUMN label;")},
+		"sql/README.md":                  {Data: []byte("ignored")},
+	}, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) != 2 || scripts[1].Name != "add_name" {
+		t.Fatalf("Expected 2 SQL migrations, got %+v", scripts)
+	}
+
+	m := New(db, nil, Options{})
+	if err := m.Register("anime", Migration{Version: 1, Name: "create_animes", Up: AutoMigrate(&Anime{}), Down: DropTables(&Anime{})}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Register("genre", scripts...); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil || applied != 3 {
+		t.Fatalf("Expected 3 migrations to apply, got %d: %v", applied, err)
+	}
+	if !db.Migrator().HasTable(&Anime{}) || !db.Migrator().HasColumn("genres", "label") {
+		t.Fatal("Expected the tables to be created")
+	}
+	if applied, err := m.Up(ctx); err != nil || applied != 0 {
+		t.Errorf("Expected nothing left to apply, got %d: %v", applied, err)
+	}
+
+	reverted, err := m.Down(ctx, "anime", 5)
+	if err != nil || reverted != 1 || db.Migrator().HasTable(&Anime{}) {
+		t.Fatalf("Expected the anime migration to be reverted, got %d: %v", reverted, err)
+	}
+	reverted, err = m.Down(ctx, "", 1)
+	if err != nil || reverted != 1 || db.Migrator().HasColumn("genres", "label") {
+		t.Fatalf("Expected the last genre migration to be reverted, got %d: %v", reverted, err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	if len(statuses) != 3 || pending != 2 || statuses[1].AppliedAt == nil {
+		t.Errorf("Unexpected status %+v", statuses)
+	}
+}
+
+func TestMigratorStopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	failure := errors.New("boom")
+	m := New(db, nil, Options{})
+	m.Register("anime",
+		Migration{Version: 1, Name: "create_animes", Up: AutoMigrate(&Anime{})},
+		Migration{Version: 2, Name: "broken", Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("ALTER TABLE animes ADD COLUMN score INTEGER").Error; err != nil {
+				return err
+			}
+			return failure
+		}},
+		Migration{Version: 3, Name: "after", Up: AutoMigrate(&Anime{})},
+	)
+
+	applied, err := m.Up(ctx)
+	if !errors.Is(err, failure) || applied != 1 {
+		t.Fatalf("Expected the second migration to fail, got %d: %v", applied, err)
+	}
+	if db.Migrator().HasColumn("animes", "score") {
+		t.Errorf("Expected the failed migration to be rolled back")
+	}
+
+	var count int64
+	db.Model(&SchemaMigration{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected only the first migration to be recorded, got %d", count)
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	m := New(newTestDB(t), nil, Options{})
+	up := AutoMigrate(&Anime{})
+	if err := m.Register("anime", Migration{Version: 1, Up: up}, Migration{Version: 1, Up: up}); err == nil {
+		t.Error("Expected duplicate versions to be rejected")
+	}
+	if err := m.Register("anime", Migration{Version: 1, Up: up}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Register("anime"); err == nil {
+		t.Error("Expected a module registered twice to be rejected")
+	}
+}
@@ -0,0 +1,146 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// sqlFiles are the scripts of one direction of a migration, by driver. The
+// empty driver is the script for every driver.
+type sqlFiles map[string]string
+
+// FromFS reads SQL migrations from dir of fsys, usually an embed.FS. Files
+// are named <version>_<name>.up.sql and <version>_<name>.down.sql, a file
+// such as 2_add_index.up.postgres.sql is run instead on that driver ("mysql"
+// or "postgres"). Statements end with a semicolon at the end of a line.
+func FromFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type scripts struct {
+		name     string
+		up, down sqlFiles
+	}
+	byVersion := make(map[int64]*scripts)
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name>.<up|down>[.<driver>].sql", entry.Name())
+		}
+		rawVersion, name, _ := strings.Cut(parts[0], "_")
+		version, err := strconv.ParseInt(rawVersion, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version %q", entry.Name(), rawVersion)
+		}
+		driver := ""
+		if len(parts) == 3 {
+			driver = parts[2]
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		s, ok := byVersion[version]
+		if !ok {
+			s = &scripts{name: name, up: sqlFiles{}, down: sqlFiles{}}
+			byVersion[version] = s
+		} else if s.name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, s.name, name)
+		}
+
+		switch parts[1] {
+		case "up":
+			s.up[driver] = string(content)
+		case "down":
+			s.down[driver] = string(content)
+		default:
+			return nil, fmt.Errorf("migration %s: direction must be up or down", entry.Name())
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, s := range byVersion {
+		if len(s.up) == 0 {
+			return nil, fmt.Errorf("migration %d_%s has no up script", version, s.name)
+		}
+		migration := Migration{Version: version, Name: s.name, Up: s.up.run}
+		if len(s.down) > 0 {
+			migration.Down = s.down.run
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MustFromFS is like FromFS but panics on an invalid migration, for scripts
+// embedded at compile time
+func MustFromFS(fsys fs.FS, dir string) []Migration {
+	migrations, err := FromFS(fsys, dir)
+	if err != nil {
+		panic("migrate: " + err.Error())
+	}
+	return migrations
+}
+
+// run executes the script of the driver of tx, or the generic one
+func (files sqlFiles) run(tx *gorm.DB) error {
+	driver := tx.Dialector.Name()
+	script, ok := files[driver]
+	if !ok {
+		if script, ok = files[""]; !ok {
+			return fmt.Errorf("no script for driver %s", driver)
+		}
+	}
+
+	for _, statement := range splitStatements(script) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on semicolons ending a line, so drivers
+// without multi-statement support can run it one statement at a time
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	code := false
+
+	flush := func() {
+		if code {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+		current.Reset()
+		code = false
+	}
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		current.WriteString(line)
+		current.WriteString("\n")
+		if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			code = true
+		}
+		if strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	flush()
+	return statements
+}
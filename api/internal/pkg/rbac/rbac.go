@@ -0,0 +1,64 @@
+package rbac
+
+import "sync"
+
+// Permission names an action on a resource, e.g. "users:delete"
+type Permission string
+
+// Wildcard grants every permission
+const Wildcard Permission = "*"
+
+// Policy maps roles to the permissions granted to them
+type Policy struct {
+	mu     sync.RWMutex
+	grants map[string]map[Permission]struct{}
+}
+
+// Default is the policy used by the RBAC middleware. Modules declare their
+// grants on it during initialization.
+var Default = NewPolicy()
+
+// NewPolicy creates an empty policy
+func NewPolicy() *Policy {
+	return &Policy{
+		grants: make(map[string]map[Permission]struct{}),
+	}
+}
+
+// Grant gives permissions to role
+func (p *Policy) Grant(role string, permissions ...Permission) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.grants[role] == nil {
+		p.grants[role] = make(map[Permission]struct{})
+	}
+	for _, permission := range permissions {
+		p.grants[role][permission] = struct{}{}
+	}
+}
+
+// Can reports whether role has been granted permission
+func (p *Policy) Can(role string, permission Permission) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	granted := p.grants[role]
+	if _, ok := granted[Wildcard]; ok {
+		return true
+	}
+	_, ok := granted[permission]
+	return ok
+}
+
+// Permissions returns the permissions granted to role
+func (p *Policy) Permissions(role string) []Permission {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	permissions := make([]Permission, 0, len(p.grants[role]))
+	for permission := range p.grants[role] {
+		permissions = append(permissions, permission)
+	}
+	return permissions
+}
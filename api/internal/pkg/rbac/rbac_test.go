@@ -0,0 +1,26 @@
+package rbac
+
+import "testing"
+
+func TestPolicy(t *testing.T) {
+	policy := NewPolicy()
+	policy.Grant("admin", Wildcard)
+	policy.Grant("user", "profile:read", "profile:write")
+
+	tests := []struct {
+		role       string
+		permission Permission
+		want       bool
+	}{
+		{"admin", "users:delete", true},
+		{"user", "profile:read", true},
+		{"user", "users:delete", false},
+		{"guest", "profile:read", false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Can(tt.role, tt.permission); got != tt.want {
+			t.Errorf("Can(%s, %s) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
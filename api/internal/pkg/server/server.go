@@ -2,8 +2,12 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"nanonime/internal/pkg/logger"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,56 +15,147 @@ import (
 	"time"
 )
 
+// DefaultShutdownTimeout is used when no shutdown timeout is configured
+const DefaultShutdownTimeout = 15 * time.Second
+
 type IServer interface {
-	Run()
-	RunWithSSL()
+	Run() error
+	RunWithSSL() error
 }
 
 type ServerContext struct {
 	Handler http.Handler
 	Host    string
 
-	CertFile interface{}
-	KeyFile  interface{}
+	// CertFile and KeyFile are PEM files used by RunWithSSL. They are
+	// re-read whenever they change on disk.
+	CertFile string
+	KeyFile  string
+
+	// MinTLSVersion is the minimum TLS version accepted by RunWithSSL,
+	// defaults to TLS 1.2
+	MinTLSVersion uint16
+
+	// CertCheckInterval is how often RunWithSSL checks the certificate files
+	// for changes, defaults to a minute
+	CertCheckInterval time.Duration
+
+	// Logger reports certificate reloads, defaults to the default logger
+	Logger *logger.Logger
 
-	Timeout      time.Duration
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
+	// RedirectHost, when set, starts a plain HTTP listener on that address
+	// that redirects every request to HTTPS
+	RedirectHost string
+
+	Timeout         time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
 }
 
 func NewServer(s ServerContext) IServer {
 	return ServerContext{
-		Host:         s.Host,
-		CertFile:     s.CertFile,
-		KeyFile:      s.KeyFile,
-		Timeout:      s.Timeout,
+		Host:              s.Host,
+		CertFile:          s.CertFile,
+		KeyFile:           s.KeyFile,
+		MinTLSVersion:     s.MinTLSVersion,
+		CertCheckInterval: s.CertCheckInterval,
+		Logger:            s.Logger,
+		RedirectHost:      s.RedirectHost,
+		Timeout:           s.Timeout,
+		ReadTimeout:       s.ReadTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		ShutdownTimeout:   s.ShutdownTimeout,
+	}
+}
+
+// Run serves HTTP until the process receives SIGINT or SIGTERM, then drains
+// in-flight requests for at most ShutdownTimeout and returns
+func (s ServerContext) Run() error {
+	server := s.httpServer()
+
+	return s.serve(waitForSignal(), []*http.Server{server}, func(ln net.Listener) error {
+		return server.Serve(ln)
+	})
+}
+
+// RunWithSSL serves HTTPS using CertFile and KeyFile until the process
+// receives SIGINT or SIGTERM. The files are checked every CertCheckInterval
+// and reloaded when they change, so renewed certificates are picked up
+// without a restart.
+func (s ServerContext) RunWithSSL() error {
+	reloader, err := newCertReloader(s.CertFile, s.KeyFile, s.Logger)
+	if err != nil {
+		return err
+	}
+	interval := s.CertCheckInterval
+	if interval <= 0 {
+		interval = certCheckInterval
+	}
+	stopWatch := reloader.watch(interval)
+	defer stopWatch()
+
+	server := s.httpServer()
+	server.TLSConfig = s.tlsConfig(reloader)
+
+	servers := []*http.Server{server}
+	var redirect *http.Server
+	if s.RedirectHost != "" {
+		redirect = &http.Server{
+			Addr:              s.RedirectHost,
+			Handler:           RedirectHandler(s.Host),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		servers = append(servers, redirect)
+	}
+
+	return s.serve(waitForSignal(), servers, func(ln net.Listener) error {
+		if redirect != nil {
+			go func() {
+				if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Printf("HTTP redirect listener failed due to err: %v", err)
+				}
+			}()
+		}
+		return server.ServeTLS(ln, "", "")
+	})
+}
+
+// httpServer builds the http.Server shared by Run and RunWithSSL
+func (s ServerContext) httpServer() *http.Server {
+	return &http.Server{
+		Addr:         s.Host,
+		Handler:      s.Handler,
 		ReadTimeout:  s.ReadTimeout,
 		WriteTimeout: s.WriteTimeout,
 		IdleTimeout:  s.IdleTimeout,
 	}
 }
 
-func (s ServerContext) Run() {
-	// Set up a channel to listen to for interrupt signals
-	var runChan = make(chan os.Signal, 1)
+// tlsConfig returns the TLS configuration backed by the certificate reloader
+func (s ServerContext) tlsConfig(reloader *certReloader) *tls.Config {
+	minVersion := s.MinTLSVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
 
-	// Set up a context to allow for graceful server shutdowns in the event
-	// of an OS interrupt (defers the cancel just in case)
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+	}
+}
 
-	ctx, cancel := context.WithTimeout(
-		context.Background(),
-		s.Timeout,
-	)
-	defer cancel()
+// serve listens on Host, runs start on a new goroutine and blocks until a
+// signal is received on stop or the server fails, then shuts down servers.
+// Signals are no longer delivered to stop once it returns.
+func (s ServerContext) serve(stop chan os.Signal, servers []*http.Server, start func(ln net.Listener) error) error {
+	defer signal.Stop(stop)
 
-	// Define server options
-	server := &http.Server{
-		Addr:         s.Host,
-		Handler:      s.Handler,
-		ReadTimeout:  s.Timeout * time.Second,
-		WriteTimeout: s.WriteTimeout * time.Second,
-		IdleTimeout:  s.IdleTimeout * time.Second,
+	ln, err := net.Listen("tcp", s.Host)
+	if err != nil {
+		return fmt.Errorf("server failed to start due to err: %w", err)
 	}
 
 	fmt.Println(`
@@ -74,33 +169,92 @@ func (s ServerContext) Run() {
 	`)
 
 	// info
-	log.Printf("Server Running on : %v", s.Host)
-
-	// Handle ctrl+c/ctrl+x interrupt
-	signal.Notify(runChan, os.Interrupt, syscall.SIGTERM)
+	log.Printf("Server Running on : %v", ln.Addr())
 
 	// Run the server on a new goroutine
+	errChan := make(chan error, 1)
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
-			if err != http.ErrServerClosed {
-				log.Fatalf("Server failed to start due to err: %v", err)
-			}
+		if err := start(ln); err != nil && err != http.ErrServerClosed {
+			errChan <- err
 		}
 	}()
 
-	// Block on this channel listeninf for those previously defined syscalls assign
-	// to variable so we can let the user know why the server is shutting down
-	interrupt := <-runChan
+	// Block until we receive one of the previously defined syscalls or the
+	// listener fails, so we can let the user know why the server is stopping
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("server failed to start due to err: %w", err)
+	case interrupt := <-stop:
+		log.Printf("Server is shutting down due to %+v", interrupt)
+	}
+
+	return s.shutdown(servers...)
+}
 
-	// If we get one of the pre-prescribed syscalls, gracefully terminate the server
-	// while alerting the user
-	log.Fatalf("Server is shutting down due to %+v\n", interrupt)
+// shutdown stops accepting new connections and waits for in-flight requests
+// until the shutdown timeout expires
+func (s ServerContext) shutdown(servers ...*http.Server) error {
+	timeout := s.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server was unable to gracefully shutdown due to err: %+v", err)
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("server was unable to gracefully shutdown due to err: %w", err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
 	}
+
+	log.Printf("Server stopped")
+	return nil
+}
+
+// waitForSignal returns a channel receiving ctrl+c/ctrl+x and SIGTERM
+func waitForSignal() chan os.Signal {
+	runChan := make(chan os.Signal, 1)
+	signal.Notify(runChan, os.Interrupt, syscall.SIGTERM)
+	return runChan
 }
 
-func (s ServerContext) RunWithSSL() {
+// RedirectHandler redirects plain HTTP requests to the HTTPS listener on
+// httpsHost, keeping the requested host name, path and query
+func RedirectHandler(httpsHost string) http.Handler {
+	_, httpsPort, _ := net.SplitHostPort(httpsHost)
 
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// ParseTLSVersion converts a version such as "1.2" or "1.3" to its crypto/tls
+// constant. An empty string selects TLS 1.2.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q", version)
+	}
 }
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for localhost
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "first")
+
+	reloader, err := newCertReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := reloader.GetCertificate(nil)
+	if name := commonName(t, cert); name != "first" {
+		t.Fatalf("expected first certificate, got %s", name)
+	}
+
+	writeSelfSignedCert(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+
+	// Handshakes keep the loaded pair until the next check
+	cert, _ = reloader.GetCertificate(nil)
+	if name := commonName(t, cert); name != "first" {
+		t.Fatalf("expected first certificate before the check, got %s", name)
+	}
+
+	reloader.check()
+	cert, _ = reloader.GetCertificate(nil)
+	if name := commonName(t, cert); name != "second" {
+		t.Fatalf("expected reloaded certificate, got %s", name)
+	}
+
+	// A broken certificate keeps the previous pair and is not retried until
+	// the files change again
+	os.WriteFile(certFile, []byte("garbage"), 0600)
+	later := future.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	reloader.check()
+	cert, _ = reloader.GetCertificate(nil)
+	if name := commonName(t, cert); name != "second" {
+		t.Fatalf("expected previous certificate after failed reload, got %s", name)
+	}
+	if !reloader.certTime.Equal(later) {
+		t.Fatalf("expected the failed attempt to be recorded, got %v", reloader.certTime)
+	}
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "first")
+
+	reloader, err := newCertReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := reloader.watch(10 * time.Millisecond)
+	defer stop()
+
+	writeSelfSignedCert(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cert, _ := reloader.GetCertificate(nil)
+		if commonName(t, cert) == "second" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the watcher to reload the certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t, t.TempDir(), "localhost")
+
+	reloader, err := newCertReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ServerContext{
+		Host:          "127.0.0.1:0",
+		MinTLSVersion: tls.VersionTLS13,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+	}
+	server := s.httpServer()
+	server.TLSConfig = s.tlsConfig(reloader)
+
+	addr := make(chan string, 1)
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve(stop, []*http.Server{server}, func(ln net.Listener) error {
+			addr <- ln.Addr().String()
+			return server.ServeTLS(ln, "", "")
+		})
+	}()
+
+	url := "https://" + <-addr
+
+	// TLS 1.2 clients are rejected by the minimum version
+	legacy := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	}}}
+	if _, err := legacy.Get(url); err == nil {
+		t.Error("expected TLS 1.2 handshake to fail")
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("expected a TLS 1.3 connection")
+	}
+
+	stop <- syscall.SIGTERM
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsHost string
+		want      string
+	}{
+		{":443", "https://example.com/api/v1/users?page=2"},
+		{":8443", "https://example.com:8443/api/v1/users?page=2"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/api/v1/users?page=2", nil)
+		rec := httptest.NewRecorder()
+		RedirectHandler(tt.httpsHost).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("expected 301, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("Location = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestHTTPServerTimeouts(t *testing.T) {
+	s := ServerContext{
+		Host:         ":0",
+		ReadTimeout:  60 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  2 * time.Minute,
+	}
+
+	server := s.httpServer()
+	if server.ReadTimeout != 60*time.Second {
+		t.Errorf("ReadTimeout = %v, want 1m0s", server.ReadTimeout)
+	}
+	if server.WriteTimeout != 30*time.Second {
+		t.Errorf("WriteTimeout = %v, want 30s", server.WriteTimeout)
+	}
+	if server.IdleTimeout != 2*time.Minute {
+		t.Errorf("IdleTimeout = %v, want 2m0s", server.IdleTimeout)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"nanonime/internal/pkg/logger"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes when no interval is configured
+const certCheckInterval = time.Minute
+
+// certReloader serves a certificate key pair and reloads it when either
+// file's modification time changes. A failed reload keeps the previous pair
+// until the files change again.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *logger.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	// certTime and keyTime are the modification times of the last load
+	// attempt, successful or not, only touched by the watch goroutine
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// newCertReloader loads the initial key pair
+func newCertReloader(certFile, keyFile string, log *logger.Logger) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("tls requires both a certificate and a key file")
+	}
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: log}
+	certTime, keyTime, err := r.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(certTime, keyTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watch checks the files every interval until the returned function is called
+func (r *certReloader) watch(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.check()
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// check reloads the key pair if the files were modified since the last
+// attempt. A broken pair is reported once, not on every check.
+func (r *certReloader) check() {
+	certTime, keyTime, err := r.modTimes()
+	if err != nil {
+		return
+	}
+	if certTime.Equal(r.certTime) && keyTime.Equal(r.keyTime) {
+		return
+	}
+
+	if err := r.load(certTime, keyTime); err != nil {
+		r.log().Error("Keeping previous TLS certificate, reload failed", "error", err)
+		return
+	}
+	r.log().Info("TLS certificate reloaded", "file", r.certFile)
+}
+
+// load reads the key pair from disk and records the modification times of
+// the attempt
+func (r *certReloader) load(certTime, keyTime time.Time) error {
+	r.certTime = certTime
+	r.keyTime = keyTime
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls key pair: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	return nil
+}
+
+func (r *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+func (r *certReloader) log() *logger.Logger {
+	if r.logger != nil {
+		return r.logger
+	}
+	return logger.Default()
+}
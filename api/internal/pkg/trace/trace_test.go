@@ -0,0 +1,43 @@
+package trace
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := Parse(header)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if sc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" || !sc.Sampled {
+		t.Errorf("Unexpected span context %+v", sc)
+	}
+	if got := sc.Traceparent(); got != header {
+		t.Errorf("Traceparent() = %q, want %q", got, header)
+	}
+
+	child := sc.Child()
+	if child.TraceID != sc.TraceID || child.SpanID == sc.SpanID {
+		t.Errorf("Child must keep the trace id and get a new span id")
+	}
+
+	ctx := NewContext(context.Background(), sc)
+	if got, ok := FromContext(ctx); !ok || got != sc {
+		t.Errorf("FromContext() = %+v, %v", got, ok)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -4,47 +4,82 @@ import (
 	"flag"
 	"nanonime/internal/app"
 	"nanonime/internal/pkg/config"
-	"nanonime/internal/pkg/logger"
 	"nanonime/internal/pkg/middleware"
 	"nanonime/modules/auth"
+	"nanonime/modules/cache"
+	"nanonime/modules/events"
 	user "nanonime/modules/users"
 	"log"
 	"os"
 )
 
 var configFile *string
+var sealSecrets *string
 
 func init() {
 	configFile = flag.String("c", "config.toml", "configuration file")
+	sealSecrets = flag.String("seal-secrets", "", "encrypt a plaintext TOML secrets file with NANONIME_SECRETS_KEY and print it")
 	flag.Parse()
 }
 
 func main() {
 
+	// Encrypt a secrets file for [secrets] file
+	if *sealSecrets != "" {
+		plain, err := os.ReadFile(*sealSecrets)
+		if err != nil {
+			log.Fatalf("Error reading secrets : %v", err)
+		}
+		sealed, err := config.EncryptSecrets(os.Getenv(config.EnvPrefix+"_SECRETS_KEY"), plain)
+		if err != nil {
+			log.Fatalf("Error encrypting secrets : %v", err)
+		}
+		os.Stdout.Write(sealed)
+		return
+	}
+
 	// Load configuration
-	cfg := config.NewConfig(*configFile)
-	if err := cfg.Initialize(); err != nil {
+	cfg, err := config.Load(*configFile)
+	if err != nil {
 		log.Fatalf("Error reading config : %v", err)
 		os.Exit(1)
 	}
 
-	// initialize logger
-	logCfg := logger.DefaultConfig()
-
 	// Start the application
-	app, err := app.NewApp(&logCfg)
+	app, err := app.NewApp(cfg)
 	if err != nil {
 		log.Fatalf("Error creating application : %v", err)
 		os.Exit(1)
 	}
-
-	// Initialize Auth middleware
-	jwtSignatureKey := config.GetJWTService()
-	middleware.InitializeAuth(jwtSignatureKey)
+	if cfg.File == "" {
+		log.Printf("Config file %s not found, using defaults and environment variables", *configFile)
+	}
 
 	// register modules
 	app.RegisterModule(user.NewModule())
 	app.RegisterModule(auth.NewModule())
+	app.RegisterModule(events.NewModule())
+	app.RegisterModule(cache.NewModule())
+
+	// Run a command instead of the server, e.g. "migrate status"
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			if err := app.Migrate(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Error running migrations : %v", err)
+			}
+		default:
+			log.Fatalf("Unknown command %q", args[0])
+		}
+		return
+	}
+
+	// Initialize Auth middleware
+	jwtService, err := cfg.JWT.Service()
+	if err != nil {
+		log.Fatalf("Error configuring JWT : %v", err)
+	}
+	middleware.InitializeAuth(jwtService)
 
 	// initialize the application
 	if err := app.Initialize(); err != nil {
@@ -53,5 +88,7 @@ func main() {
 	}
 
 	// Start the application
-	app.Start()
+	if err := app.Start(); err != nil {
+		log.Fatalf("Error running application : %v", err)
+	}
 }
@@ -0,0 +1,52 @@
+package auth
+
+import "nanonime/internal/pkg/config"
+
+// FeatureRequireVerifiedEmail is the flag under [features] refusing logins
+// of accounts whose email address is not verified
+const FeatureRequireVerifiedEmail = "require_verified_email"
+
+// Config is the [modules.auth] section
+type Config struct {
+	// AttemptStore keeps failed logins in "memory", the "database" or the
+	// application "cache"
+	AttemptStore         string `mapstructure:"attempt_store"`
+	LockoutThreshold     int    `mapstructure:"lockout_threshold"`
+	IPLockoutThreshold   int    `mapstructure:"ip_lockout_threshold"`
+	LockoutMinutes       int    `mapstructure:"lockout_minutes"`
+	BackoffFreeAttempts  int    `mapstructure:"backoff_free_attempts"`
+	BackoffBaseSeconds   int    `mapstructure:"backoff_base_seconds"`
+	BackoffMaxSeconds    int    `mapstructure:"backoff_max_seconds"`
+	AttemptWindowMinutes int    `mapstructure:"attempt_window_minutes"`
+	// PasswordResetsPerHour limits the password reset requests of each
+	// client IP
+	PasswordResetsPerHour int `mapstructure:"password_resets_per_hour"`
+}
+
+// DefaultConfig returns the settings used for keys that are not set
+func DefaultConfig() Config {
+	return Config{
+		AttemptStore:          "memory",
+		LockoutThreshold:      10,
+		IPLockoutThreshold:    50,
+		LockoutMinutes:        15,
+		BackoffFreeAttempts:   3,
+		BackoffBaseSeconds:    1,
+		BackoffMaxSeconds:     60,
+		AttemptWindowMinutes:  15,
+		PasswordResetsPerHour: 5,
+	}
+}
+
+// Validate reports invalid settings
+func (c Config) Validate(v *config.Validator) {
+	v.OneOf("attempt_store", c.AttemptStore, "memory", "database", "cache")
+	v.Positive("lockout_threshold", c.LockoutThreshold)
+	v.Positive("ip_lockout_threshold", c.IPLockoutThreshold)
+	v.Positive("lockout_minutes", c.LockoutMinutes)
+	v.NonNegative("backoff_free_attempts", c.BackoffFreeAttempts)
+	v.NonNegative("backoff_base_seconds", c.BackoffBaseSeconds)
+	v.NonNegative("backoff_max_seconds", c.BackoffMaxSeconds)
+	v.Positive("attempt_window_minutes", c.AttemptWindowMinutes)
+	v.Positive("password_resets_per_hour", c.PasswordResetsPerHour)
+}
@@ -0,0 +1,24 @@
+package entity
+
+import (
+	"time"
+)
+
+// LoginAttempt tracks failed logins for an account or an IP address
+type LoginAttempt struct {
+	Key         string    `gorm:"column:attempt_key;primaryKey;size:191" json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+	ExpiresAt   time.Time `gorm:"index" json:"expires_at"`
+}
+
+// TableName specifies the table name for LoginAttempt
+func (*LoginAttempt) TableName() string {
+	return "login_attempts"
+}
+
+// IsLocked reports whether the key is locked out at now
+func (a *LoginAttempt) IsLocked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
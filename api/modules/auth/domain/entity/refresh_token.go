@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"time"
+)
+
+// RefreshToken represents an opaque refresh token issued at login. Only the
+// SHA-256 hash of the token is stored. Tokens rotated from the same login
+// share a FamilyID so a reused token can revoke the whole chain.
+// AccessTokenID is the id of the access token issued together with it, empty
+// for tokens issued before it was recorded.
+type RefreshToken struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"index;not null" json:"user_id"`
+	FamilyID      string     `gorm:"size:64;index;not null" json:"family_id"`
+	TokenHash     string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	AccessTokenID string     `gorm:"size:64" json:"-"`
+	UserAgent     string     `gorm:"size:255" json:"user_agent"`
+	IPAddress     string     `gorm:"size:64" json:"ip_address"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for RefreshToken
+func (*RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// IsExpired reports whether the token is past its expiry time
+func (t *RefreshToken) IsExpired(now time.Time) bool {
+	return now.After(t.ExpiresAt)
+}
+
+// IsRevoked reports whether the token has been revoked or already rotated
+func (t *RefreshToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
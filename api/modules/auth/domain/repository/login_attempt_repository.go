@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"nanonime/modules/auth/domain/entity"
+	"time"
+)
+
+// LoginAttemptRepository stores failed login counters. Records expire after
+// the ttl returned by the function given to Update.
+type LoginAttemptRepository interface {
+	// Get returns nil when the key has no active record
+	Get(ctx context.Context, key string) (*entity.LoginAttempt, error)
+	// Update atomically replaces the record of key with the one returned by
+	// fn, which receives the active record or nil, even when the store is
+	// shared by several instances. fn may run more than once.
+	Update(ctx context.Context, key string, fn UpdateAttemptFunc) (*entity.LoginAttempt, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// UpdateAttemptFunc returns the new record of a key and how long to keep it
+type UpdateAttemptFunc func(current *entity.LoginAttempt) (*entity.LoginAttempt, time.Duration)
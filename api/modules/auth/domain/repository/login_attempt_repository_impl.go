@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"nanonime/internal/pkg/cache"
+	"nanonime/internal/pkg/database"
+	"nanonime/modules/auth/domain/entity"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptRepositoryImpl stores login attempts in the database, so
+// counters are shared by every instance of the API
+type LoginAttemptRepositoryImpl struct{}
+
+// Get implements LoginAttemptRepository.
+func (r LoginAttemptRepositoryImpl) Get(ctx context.Context, key string) (*entity.LoginAttempt, error) {
+	var attempt entity.LoginAttempt
+	result := database.DB.WithContext(ctx).Where("attempt_key = ? AND expires_at > ?", key, time.Now()).First(&attempt)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &attempt, nil
+}
+
+// Update implements LoginAttemptRepository. The row is locked for the
+// transaction, so concurrent failures from other instances queue up.
+func (r LoginAttemptRepositoryImpl) Update(ctx context.Context, key string, fn UpdateAttemptFunc) (*entity.LoginAttempt, error) {
+	var updated *entity.LoginAttempt
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Make sure there is a row to lock, an expired one reads as no record
+		placeholder := entity.LoginAttempt{Key: key, ExpiresAt: time.Unix(0, 0)}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&placeholder).Error; err != nil {
+			return err
+		}
+
+		var current entity.LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("attempt_key = ?", key).First(&current).Error; err != nil {
+			return err
+		}
+		var active *entity.LoginAttempt
+		if current.ExpiresAt.After(time.Now()) {
+			active = &current
+		}
+
+		attempt, ttl := fn(active)
+		attempt.Key = key
+		attempt.ExpiresAt = time.Now().Add(ttl)
+		updated = attempt
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(attempt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Delete implements LoginAttemptRepository.
+func (r LoginAttemptRepositoryImpl) Delete(ctx context.Context, key string) error {
+	return database.DB.WithContext(ctx).Where("attempt_key = ?", key).Delete(&entity.LoginAttempt{}).Error
+}
+
+// DeleteExpired deletes the records that expired and returns how many were
+// deleted. Get ignores them, but without a purge every address that ever
+// failed a login keeps its row.
+func (r LoginAttemptRepositoryImpl) DeleteExpired(ctx context.Context) (int64, error) {
+	result := database.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&entity.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
+
+func NewLoginAttemptRepositoryImpl() LoginAttemptRepository {
+	return LoginAttemptRepositoryImpl{}
+}
+
+// LoginAttemptCacheRepository stores login attempts in a cache store, in
+// process memory for a single instance or in Redis to share them
+type LoginAttemptCacheRepository struct {
+	cache *cache.Cache[entity.LoginAttempt]
+}
+
+// Get implements LoginAttemptRepository.
+func (r *LoginAttemptCacheRepository) Get(ctx context.Context, key string) (*entity.LoginAttempt, error) {
+	attempt, found, err := r.cache.Get(ctx, key)
+	if err != nil || !found {
+		return nil, err
+	}
+	if time.Now().After(attempt.ExpiresAt) {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+// Update implements LoginAttemptRepository with an atomic update of the
+// store, a transaction in Redis
+func (r *LoginAttemptCacheRepository) Update(ctx context.Context, key string, fn UpdateAttemptFunc) (*entity.LoginAttempt, error) {
+	updated, err := r.cache.Update(ctx, key, func(current entity.LoginAttempt, found bool) (entity.LoginAttempt, time.Duration, error) {
+		var active *entity.LoginAttempt
+		if found && !time.Now().After(current.ExpiresAt) {
+			active = &current
+		}
+
+		attempt, ttl := fn(active)
+		attempt.Key = key
+		attempt.ExpiresAt = time.Now().Add(ttl)
+		return *attempt, ttl, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// Delete implements LoginAttemptRepository.
+func (r *LoginAttemptCacheRepository) Delete(ctx context.Context, key string) error {
+	return r.cache.Delete(ctx, key)
+}
+
+// NewLoginAttemptCacheRepository creates a repository on store
+func NewLoginAttemptCacheRepository(store cache.Store) LoginAttemptRepository {
+	return &LoginAttemptCacheRepository{
+		cache: cache.New[entity.LoginAttempt](store, cache.Config{Namespace: "auth:login_attempts"}),
+	}
+}
+
+// NewLoginAttemptMemoryRepository creates an in-memory repository whose
+// expired entries are purged every retention
+func NewLoginAttemptMemoryRepository(retention time.Duration) LoginAttemptRepository {
+	if retention < time.Minute {
+		retention = time.Minute
+	}
+	return NewLoginAttemptCacheRepository(cache.NewMemoryStore(retention))
+}
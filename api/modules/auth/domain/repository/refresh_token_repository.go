@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"nanonime/modules/auth/domain/entity"
+	"time"
+)
+
+// RefreshTokenRepository defines the refresh token repository interface
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *entity.RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (*entity.RefreshToken, error)
+	// Revoke revokes a single token and reports whether it was still active
+	Revoke(ctx context.Context, id uint) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeAllForUser(ctx context.Context, userID uint) error
+	// FindUserIssuedSince and FindFamilyIssuedSince return the tokens issued
+	// at or after since, whose access tokens may still be valid
+	FindUserIssuedSince(ctx context.Context, userID uint, since time.Time) ([]*entity.RefreshToken, error)
+	FindFamilyIssuedSince(ctx context.Context, familyID string, since time.Time) ([]*entity.RefreshToken, error)
+}
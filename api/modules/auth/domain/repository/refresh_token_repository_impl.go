@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"nanonime/internal/pkg/database"
+	"nanonime/modules/auth/domain/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ERR_RECORD_NOT_FOUND = errors.New("record not found")
+)
+
+type RefreshTokenRepositoryImpl struct{}
+
+// Create implements RefreshTokenRepository.
+func (r RefreshTokenRepositoryImpl) Create(ctx context.Context, token *entity.RefreshToken) error {
+	return database.DB.WithContext(ctx).Create(token).Error
+}
+
+// FindByHash implements RefreshTokenRepository.
+func (r RefreshTokenRepositoryImpl) FindByHash(ctx context.Context, hash string) (*entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	result := database.DB.WithContext(ctx).Where("token_hash = ?", hash).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ERR_RECORD_NOT_FOUND
+		}
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// Revoke implements RefreshTokenRepository. The update is conditional so two
+// concurrent refreshes of the same token cannot both succeed.
+func (r RefreshTokenRepositoryImpl) Revoke(ctx context.Context, id uint) (bool, error) {
+	result := database.DB.WithContext(ctx).
+		Model(&entity.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeFamily implements RefreshTokenRepository.
+func (r RefreshTokenRepositoryImpl) RevokeFamily(ctx context.Context, familyID string) error {
+	return database.DB.WithContext(ctx).
+		Model(&entity.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllForUser implements RefreshTokenRepository.
+func (r RefreshTokenRepositoryImpl) RevokeAllForUser(ctx context.Context, userID uint) error {
+	return database.DB.WithContext(ctx).
+		Model(&entity.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// FindUserIssuedSince implements RefreshTokenRepository.
+func (r RefreshTokenRepositoryImpl) FindUserIssuedSince(ctx context.Context, userID uint, since time.Time) ([]*entity.RefreshToken, error) {
+	var tokens []*entity.RefreshToken
+	err := database.DB.WithContext(ctx).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// FindFamilyIssuedSince implements RefreshTokenRepository.
+func (r RefreshTokenRepositoryImpl) FindFamilyIssuedSince(ctx context.Context, familyID string, since time.Time) ([]*entity.RefreshToken, error) {
+	var tokens []*entity.RefreshToken
+	err := database.DB.WithContext(ctx).
+		Where("family_id = ? AND created_at >= ?", familyID, since).
+		Find(&tokens).Error
+	return tokens, err
+}
+
+func NewRefreshTokenRepositoryImpl() RefreshTokenRepository {
+	return RefreshTokenRepositoryImpl{}
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"nanonime/internal/contract/users"
+)
+
+// UserRepository defines the user operations the auth module needs from the
+// user module. Lookups return ERR_RECORD_NOT_FOUND for unknown users.
+type UserRepository interface {
+	FindByID(ctx context.Context, id uint) (*users.Account, error)
+	FindByEmail(ctx context.Context, email string) (*users.Account, error)
+	// Create stores a new user with an already hashed password
+	Create(ctx context.Context, name, email, passwordHash string) (*users.Account, error)
+	// CheckPassword returns the user with id, or email when id is zero, and
+	// users.ErrInvalidPassword when password does not match
+	CheckPassword(ctx context.Context, id uint, email, password string) (*users.Account, error)
+	SetPassword(ctx context.Context, id uint, passwordHash string) (*users.Account, error)
+	VerifyEmail(ctx context.Context, id uint) (*users.Account, error)
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"nanonime/internal/contract/users"
+	"nanonime/internal/pkg/bus"
+)
+
+// UserRepositoryImpl asks the user module for users over the event bus
+type UserRepositoryImpl struct {
+	event *bus.EventBus
+}
+
+// FindByID implements UserRepository.
+func (r UserRepositoryImpl) FindByID(ctx context.Context, id uint) (*users.Account, error) {
+	user, err := bus.Request[users.FindUserByID, *users.Account](ctx, r.event, users.FindUserByID{ID: id})
+	return user, notFound(err)
+}
+
+// FindByEmail implements UserRepository.
+func (r UserRepositoryImpl) FindByEmail(ctx context.Context, email string) (*users.Account, error) {
+	user, err := bus.Request[users.FindUserByEmail, *users.Account](ctx, r.event, users.FindUserByEmail{Email: email})
+	return user, notFound(err)
+}
+
+// Create implements UserRepository.
+func (r UserRepositoryImpl) Create(ctx context.Context, name, email, passwordHash string) (*users.Account, error) {
+	return bus.Request[users.CreateUser, *users.Account](ctx, r.event, users.CreateUser{Name: name, Email: email, PasswordHash: passwordHash})
+}
+
+// CheckPassword implements UserRepository.
+func (r UserRepositoryImpl) CheckPassword(ctx context.Context, id uint, email, password string) (*users.Account, error) {
+	user, err := bus.Request[users.CheckPassword, *users.Account](ctx, r.event, users.CheckPassword{ID: id, Email: email, Password: password})
+	return user, notFound(err)
+}
+
+// SetPassword implements UserRepository.
+func (r UserRepositoryImpl) SetPassword(ctx context.Context, id uint, passwordHash string) (*users.Account, error) {
+	user, err := bus.Request[users.SetPassword, *users.Account](ctx, r.event, users.SetPassword{ID: id, PasswordHash: passwordHash})
+	return user, notFound(err)
+}
+
+// VerifyEmail implements UserRepository.
+func (r UserRepositoryImpl) VerifyEmail(ctx context.Context, id uint) (*users.Account, error) {
+	user, err := bus.Request[users.VerifyEmail, *users.Account](ctx, r.event, users.VerifyEmail{ID: id})
+	return user, notFound(err)
+}
+
+// notFound maps users.ErrUserNotFound to ERR_RECORD_NOT_FOUND
+func notFound(err error) error {
+	if errors.Is(err, users.ErrUserNotFound) {
+		return ERR_RECORD_NOT_FOUND
+	}
+	return err
+}
+
+func NewUserRepositoryImpl(event *bus.EventBus) UserRepository {
+	return UserRepositoryImpl{event: event}
+}
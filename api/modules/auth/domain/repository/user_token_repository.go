@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"nanonime/modules/auth/domain/entity"
+)
+
+// UserTokenRepository defines the user token repository interface
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *entity.UserToken) error
+	FindByHash(ctx context.Context, hash, purpose string) (*entity.UserToken, error)
+	// MarkUsed consumes a token and reports whether it was still unused
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	// InvalidateForUser consumes every outstanding token of a user for purpose
+	InvalidateForUser(ctx context.Context, userID uint, purpose string) error
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"nanonime/internal/pkg/database"
+	"nanonime/modules/auth/domain/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UserTokenRepositoryImpl struct{}
+
+// Create implements UserTokenRepository.
+func (r UserTokenRepositoryImpl) Create(ctx context.Context, token *entity.UserToken) error {
+	return database.DB.WithContext(ctx).Create(token).Error
+}
+
+// FindByHash implements UserTokenRepository.
+func (r UserTokenRepositoryImpl) FindByHash(ctx context.Context, hash, purpose string) (*entity.UserToken, error) {
+	var token entity.UserToken
+	result := database.DB.WithContext(ctx).Where("token_hash = ? AND purpose = ?", hash, purpose).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ERR_RECORD_NOT_FOUND
+		}
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// MarkUsed implements UserTokenRepository.
+func (r UserTokenRepositoryImpl) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	result := database.DB.WithContext(ctx).
+		Model(&entity.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateForUser implements UserTokenRepository.
+func (r UserTokenRepositoryImpl) InvalidateForUser(ctx context.Context, userID uint, purpose string) error {
+	return database.DB.WithContext(ctx).
+		Model(&entity.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+func NewUserTokenRepositoryImpl() UserTokenRepository {
+	return UserTokenRepositoryImpl{}
+}
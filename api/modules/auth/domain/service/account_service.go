@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nanonime/internal/contract/users"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/mailer"
+	"nanonime/internal/pkg/utils"
+	authEntity "nanonime/modules/auth/domain/entity"
+	authRepository "nanonime/modules/auth/domain/repository"
+	"net/url"
+	"time"
+)
+
+// Errors
+var (
+	ErrInvalidUserToken     = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+)
+
+// Lifetimes of single-use tokens
+const (
+	EmailVerificationTTL = 24 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+// EventPasswordResetRequested is published when a password reset link is
+// asked for, the mail is sent by its subscriber
+const EventPasswordResetRequested = "auth.password_reset_requested"
+
+// PasswordResetRequested is the payload of EventPasswordResetRequested
+type PasswordResetRequested struct {
+	Email string `json:"email"`
+}
+
+// EventName returns EventPasswordResetRequested
+func (PasswordResetRequested) EventName() string {
+	return EventPasswordResetRequested
+}
+
+// AccountService handles email verification and password recovery
+type AccountService struct {
+	event        *bus.EventBus
+	userRepo     authRepository.UserRepository
+	tokenRepo    authRepository.UserTokenRepository
+	tokenService *TokenService
+	mailer       mailer.Mailer
+	baseURL      string
+}
+
+// NewAccountService creates a new AccountService. baseURL is the prefix of the
+// links sent by email.
+func NewAccountService(event *bus.EventBus, userRepo authRepository.UserRepository, tokenRepo authRepository.UserTokenRepository, tokenService *TokenService, mailer mailer.Mailer, baseURL string) *AccountService {
+	return &AccountService{
+		event:        event,
+		userRepo:     userRepo,
+		tokenRepo:    tokenRepo,
+		tokenService: tokenService,
+		mailer:       mailer,
+		baseURL:      baseURL,
+	}
+}
+
+// SendEmailVerification mails a verification link to user
+func (s *AccountService) SendEmailVerification(ctx context.Context, user *users.Account) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.issue(ctx, user.ID, authEntity.PurposeEmailVerification, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.link("/verify-email", token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in 24 hours.\n",
+			user.Name, link),
+	})
+}
+
+// ResendEmailVerification mails a new verification link to the user with id.
+// It returns ErrUserNotFound only for unknown users, other failures are
+// passed through so callers can retry.
+func (s *AccountService) ResendEmailVerification(ctx context.Context, userID uint) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, authRepository.ERR_RECORD_NOT_FOUND) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return s.SendEmailVerification(ctx, user)
+}
+
+// ConfirmEmail marks the email of the token's user as verified
+func (s *AccountService) ConfirmEmail(ctx context.Context, token string) (*users.Account, error) {
+	user, err := s.consume(ctx, token, authEntity.PurposeEmailVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.VerifyEmail(ctx, user.ID)
+}
+
+// RequestPasswordReset publishes EventPasswordResetRequested. The account is
+// looked up and the mail sent by the subscriber, so neither the outcome nor
+// the time taken tells callers whether email belongs to an account.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) {
+	bus.PublishContext(ctx, s.event, PasswordResetRequested{Email: email})
+}
+
+// SendPasswordReset mails a password reset link when email belongs to a
+// user, unknown addresses are ignored
+func (s *AccountService) SendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, authRepository.ERR_RECORD_NOT_FOUND) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.issue(ctx, user.ID, authEntity.PurposePasswordReset, PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.link("/reset-password", token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your password. If it was you, open the link below:\n\n%s\n\nThe link expires in 1 hour. If you did not ask for this, you can ignore this email.\n",
+			user.Name, link),
+	})
+}
+
+// ResetPassword sets a new password for the token's user and revokes all of
+// their sessions
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) (*users.Account, error) {
+	user, err := s.consume(ctx, token, authEntity.PurposePasswordReset)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+	if user, err = s.userRepo.SetPassword(ctx, user.ID, hashedPassword); err != nil {
+		return nil, err
+	}
+
+	// Receiving the reset mail proves ownership of the address
+	if user.EmailVerifiedAt == nil {
+		if user, err = s.userRepo.VerifyEmail(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.tokenService.RevokeAllForUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// issue replaces the user's outstanding tokens for purpose with a new one
+func (s *AccountService) issue(ctx context.Context, userID uint, purpose string, ttl time.Duration) (string, error) {
+	if err := s.tokenRepo.InvalidateForUser(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.tokenRepo.Create(ctx, &authEntity.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consume uses up a token and returns its user
+func (s *AccountService) consume(ctx context.Context, token, purpose string) (*users.Account, error) {
+	if token == "" {
+		return nil, ErrInvalidUserToken
+	}
+
+	record, err := s.tokenRepo.FindByHash(ctx, hashToken(token), purpose)
+	if err != nil {
+		if err == authRepository.ERR_RECORD_NOT_FOUND {
+			return nil, ErrInvalidUserToken
+		}
+		return nil, err
+	}
+
+	if !record.IsUsable(time.Now()) {
+		return nil, ErrInvalidUserToken
+	}
+
+	used, err := s.tokenRepo.MarkUsed(ctx, record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidUserToken
+	}
+
+	user, err := s.userRepo.FindByID(ctx, record.UserID)
+	if err != nil {
+		if errors.Is(err, authRepository.ERR_RECORD_NOT_FOUND) {
+			return nil, ErrInvalidUserToken
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *AccountService) link(path, token string) string {
+	return s.baseURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"nanonime/internal/contract/users"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/database"
+	"nanonime/internal/pkg/mailer"
+	authEntity "nanonime/modules/auth/domain/entity"
+	authRepository "nanonime/modules/auth/domain/repository"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// failingUsers answers every lookup with err
+type failingUsers struct {
+	authRepository.UserRepository
+	err error
+}
+
+func (r failingUsers) FindByID(ctx context.Context, id uint) (*users.Account, error) {
+	return nil, r.err
+}
+
+func TestResendEmailVerificationErrors(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewAccountService(nil, failingUsers{err: authRepository.ERR_RECORD_NOT_FOUND}, nil, nil, nil, "")
+	if err := s.ResendEmailVerification(ctx, 1); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound for an unknown user, got %v", err)
+	}
+
+	// Transient failures are returned so the bus retries the mail
+	outage := errors.New("request timed out")
+	s = NewAccountService(nil, failingUsers{err: outage}, nil, nil, nil, "")
+	if err := s.ResendEmailVerification(ctx, 1); !errors.Is(err, outage) {
+		t.Errorf("expected the lookup error, got %v", err)
+	}
+}
+
+func TestRequestPasswordResetIsAsynchronous(t *testing.T) {
+	event := bus.NewEventBus()
+	defer event.Close()
+
+	var requested []string
+	bus.Subscribe(event, func(e PasswordResetRequested) { requested = append(requested, e.Email) })
+
+	// The lookup happens in the subscriber, so a failing store is not seen
+	s := NewAccountService(event, failingUsers{err: errors.New("down")}, nil, nil, nil, "")
+	s.RequestPasswordReset(context.Background(), "user@example.com")
+
+	event.Wait()
+	if len(requested) != 1 || requested[0] != "user@example.com" {
+		t.Errorf("expected one reset request, got %v", requested)
+	}
+}
+
+// outbox keeps the messages it is asked to send
+type outbox struct {
+	sent []mailer.Message
+}
+
+func (o *outbox) Send(ctx context.Context, msg mailer.Message) error {
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=(\S+)`)
+
+// token returns the token of the link in the last message
+func (o *outbox) token(t *testing.T) string {
+	t.Helper()
+	if len(o.sent) == 0 {
+		t.Fatal("expected a message to be sent")
+	}
+	match := linkToken.FindStringSubmatch(o.sent[len(o.sent)-1].Text)
+	if match == nil {
+		t.Fatal("expected the message to contain a link")
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func newAccountFixture(t *testing.T) (*AccountService, *tokenFixture, *outbox) {
+	t.Helper()
+	f := newTokenFixture(t)
+	mail := &outbox{}
+	s := NewAccountService(nil, f.users, authRepository.NewUserTokenRepositoryImpl(), f.service, mail, "https://example.com")
+	return s, f, mail
+}
+
+func TestEmailVerification(t *testing.T) {
+	ctx := context.Background()
+	s, f, mail := newAccountFixture(t)
+
+	if err := s.ResendEmailVerification(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	stale := mail.token(t)
+
+	// Asking again replaces the outstanding link
+	if err := s.ResendEmailVerification(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	token := mail.token(t)
+	if _, err := s.ConfirmEmail(ctx, stale); err != ErrInvalidUserToken {
+		t.Errorf("expected the replaced token to be refused, got %v", err)
+	}
+
+	user, err := s.ConfirmEmail(ctx, token)
+	if err != nil {
+		t.Fatalf("confirm email: %v", err)
+	}
+	if user.EmailVerifiedAt == nil || f.users.accounts[1].EmailVerifiedAt == nil {
+		t.Error("expected the email address to be verified")
+	}
+
+	if _, err := s.ConfirmEmail(ctx, token); err != ErrInvalidUserToken {
+		t.Errorf("expected the token to be single-use, got %v", err)
+	}
+	if err := s.ResendEmailVerification(ctx, 1); err != ErrEmailAlreadyVerified {
+		t.Errorf("expected ErrEmailAlreadyVerified, got %v", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	s, f, mail := newAccountFixture(t)
+	session := f.login(t)
+
+	if err := s.SendPasswordReset(ctx, "nobody@example.com"); err != nil || len(mail.sent) != 0 {
+		t.Fatalf("expected unknown addresses to be ignored, got %v and %d messages", err, len(mail.sent))
+	}
+
+	if err := s.SendPasswordReset(ctx, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := mail.token(t)
+
+	user, err := s.ResetPassword(ctx, token, "new-password")
+	if err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	if f.users.passwords[1] == "" || f.users.passwords[1] == "new-password" {
+		t.Error("expected the new password to be stored hashed")
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("expected the reset to verify the email address")
+	}
+	if !f.revoked(t, session) {
+		t.Error("expected the sessions of the user to be revoked")
+	}
+
+	if _, err := s.ResetPassword(ctx, token, "another-password"); err != ErrInvalidUserToken {
+		t.Errorf("expected the token to be single-use, got %v", err)
+	}
+}
+
+func TestExpiredUserToken(t *testing.T) {
+	ctx := context.Background()
+	s, _, mail := newAccountFixture(t)
+
+	if err := s.SendPasswordReset(ctx, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(&authEntity.UserToken{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+
+	if _, err := s.ResetPassword(ctx, mail.token(t), "new-password"); err != ErrInvalidUserToken {
+		t.Errorf("expected an expired token to be refused, got %v", err)
+	}
+}
@@ -3,10 +3,11 @@ package service
 import (
 	"context"
 	"errors"
+	"nanonime/internal/contract/users"
 	"nanonime/internal/pkg/jwt"
 	"nanonime/internal/pkg/utils"
-	"nanonime/modules/users/domain/entity"
-	"nanonime/modules/users/domain/repository"
+	authRepository "nanonime/modules/auth/domain/repository"
+	"sync/atomic"
 )
 
 // Errors
@@ -14,16 +15,20 @@ var (
 	ErrUserNotFound     = errors.New("user not found")
 	ErrEmailAlreadyUsed = errors.New("email already in use")
 	ErrInvalidPassword  = errors.New("invalid password")
+	ErrEmailNotVerified = errors.New("email not verified")
 )
 
 // AuthService handles user authentication
 type AuthService struct {
-	userRepo repository.UserRepository
+	userRepo authRepository.UserRepository
 	jwt      jwt.JWT
+
+	// requireVerifiedEmail refuses logins of unverified accounts
+	requireVerifiedEmail atomic.Bool
 }
 
 // NewAuthService creates a new AuthService
-func NewAuthService(userRepo repository.UserRepository) *AuthService {
+func NewAuthService(userRepo authRepository.UserRepository) *AuthService {
 	if userRepo == nil {
 		panic("userRepo cannot be nil")
 	}
@@ -32,73 +37,84 @@ func NewAuthService(userRepo repository.UserRepository) *AuthService {
 	}
 }
 
-// CreateUser creates a new user
-func (s *AuthService) CreateUser(ctx context.Context, user *entity.User) error {
-	if user.Email == "" || user.Password == "" {
-		return errors.New("email and password cannot be empty")
+// SetRequireVerifiedEmail sets whether users must verify their email address
+// before they can log in
+func (s *AuthService) SetRequireVerifiedEmail(required bool) {
+	s.requireVerifiedEmail.Store(required)
+}
+
+// CreateUser creates a new user with a hashed copy of password
+func (s *AuthService) CreateUser(ctx context.Context, name, email, password string) (*users.Account, error) {
+	if email == "" || password == "" {
+		return nil, errors.New("email and password cannot be empty")
 	}
 
-	existingUser, err := s.userRepo.FindByEmail(ctx, user.Email)
-	if err != nil && err != repository.ERR_RECORD_NOT_FOUND {
-		return err
+	existingUser, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil && err != authRepository.ERR_RECORD_NOT_FOUND {
+		return nil, err
 	}
 	if existingUser != nil {
-		return ErrEmailAlreadyUsed
+		return nil, ErrEmailAlreadyUsed
 	}
 
 	// Hash the password before saving the user
-	hashedPassword, err := utils.HashPassword(user.Password)
+	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	user.Password = hashedPassword
 
-	return s.userRepo.Create(ctx, user)
+	return s.userRepo.Create(ctx, name, email, hashedPassword)
 }
 
 // ProcessLogin handles user login and password verification
-func (s *AuthService) ProcessLogin(ctx context.Context, email, password string) (*entity.User, error) {
+func (s *AuthService) ProcessLogin(ctx context.Context, email, password string) (*users.Account, error) {
 	// Validate input
 	if email == "" || password == "" {
 		return nil, errors.New("email and password cannot be empty")
 	}
 
-	// Find user by email
-	existingUser, err := s.userRepo.FindByEmail(ctx, email)
+	// The user module compares the password with the stored hash
+	user, err := s.userRepo.CheckPassword(ctx, 0, email, password)
 	if err != nil {
-		if err == repository.ERR_RECORD_NOT_FOUND {
+		if err == authRepository.ERR_RECORD_NOT_FOUND {
 			return nil, ErrUserNotFound
 		}
+		if errors.Is(err, users.ErrInvalidPassword) {
+			return nil, ErrInvalidPassword
+		}
 		return nil, err
 	}
 
-	// Compare the provided password with the hashed password in the database
-	if !utils.CompareHashAndPassword(existingUser.Password, password) {
-		return nil, ErrInvalidPassword
+	if user.EmailVerifiedAt == nil && s.requireVerifiedEmail.Load() {
+		return nil, ErrEmailNotVerified
 	}
 
 	// Return the authenticated user
-	return existingUser, nil
+	return user, nil
 }
 
-func (s *AuthService) ChangePassword(ctx context.Context, userID uint, password string) (*entity.User, error) {
+// ChangePassword replaces a user's password after verifying the current one
+func (s *AuthService) ChangePassword(ctx context.Context, userID uint, oldPassword, password string) (*users.Account, error) {
 	if password == "" {
 		return nil, errors.New("password cannot be empty")
 	}
 
-	hashedPassword, err := utils.HashPassword(password)
-	if err != nil {
-		return nil, errors.New("failed to hash password")
+	if _, err := s.userRepo.CheckPassword(ctx, userID, "", oldPassword); err != nil {
+		if err == authRepository.ERR_RECORD_NOT_FOUND {
+			return nil, ErrUserNotFound
+		}
+		if errors.Is(err, users.ErrInvalidPassword) {
+			return nil, ErrInvalidPassword
+		}
+		return nil, err
 	}
 
-	user, err := s.userRepo.FindByID(ctx, userID)
+	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
-		return nil, errors.New("user not found")
+		return nil, errors.New("failed to hash password")
 	}
 
-	user.Password = hashedPassword
-
-	err = s.userRepo.Update(ctx, user)
+	user, err := s.userRepo.SetPassword(ctx, userID, hashedPassword)
 	if err != nil {
 		return nil, errors.New("failed to update password")
 	}
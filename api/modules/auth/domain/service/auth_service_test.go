@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"nanonime/internal/contract/users"
+	authRepository "nanonime/modules/auth/domain/repository"
+	"testing"
+	"time"
+)
+
+// passwordUsers accepts every password of its account
+type passwordUsers struct {
+	authRepository.UserRepository
+	account users.Account
+}
+
+func (r passwordUsers) CheckPassword(ctx context.Context, id uint, email, password string) (*users.Account, error) {
+	account := r.account
+	return &account, nil
+}
+
+func TestProcessLoginRequiresVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	s := NewAuthService(passwordUsers{account: users.Account{ID: 1, Email: "user@example.com"}})
+
+	if _, err := s.ProcessLogin(ctx, "user@example.com", "secret"); err != nil {
+		t.Fatalf("expected unverified accounts to log in by default, got %v", err)
+	}
+
+	s.SetRequireVerifiedEmail(true)
+	if _, err := s.ProcessLogin(ctx, "user@example.com", "secret"); err != ErrEmailNotVerified {
+		t.Fatalf("expected ErrEmailNotVerified, got %v", err)
+	}
+
+	verifiedAt := time.Now()
+	s = NewAuthService(passwordUsers{account: users.Account{ID: 1, Email: "user@example.com", EmailVerifiedAt: &verifiedAt}})
+	s.SetRequireVerifiedEmail(true)
+	if _, err := s.ProcessLogin(ctx, "user@example.com", "secret"); err != nil {
+		t.Fatalf("expected verified accounts to log in, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"nanonime/internal/pkg/bus"
+	authEntity "nanonime/modules/auth/domain/entity"
+	authRepository "nanonime/modules/auth/domain/repository"
+	"strings"
+	"time"
+)
+
+// Lockout scopes
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// EventLockout is published on the event bus whenever an account or IP address
+// is locked out
+const EventLockout = "auth.lockout"
+
+// LockedError is returned when a login is refused because of previous failures
+type LockedError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts for %s, retry in %s", e.Scope, e.RetryAfter.Round(time.Second))
+}
+
+// LockoutEvent is the payload of EventLockout
+type LockoutEvent struct {
+	Scope       string    `json:"scope"`
+	Subject     string    `json:"subject"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// EventName returns EventLockout
+func (LockoutEvent) EventName() string {
+	return EventLockout
+}
+
+// LoginGuardConfig configures brute-force protection
+type LoginGuardConfig struct {
+	// AccountThreshold and IPThreshold are the failures after which an
+	// account or IP address is locked out
+	AccountThreshold int
+	IPThreshold      int
+	LockoutDuration  time.Duration
+
+	// FreeAttempts failures are allowed before backoff starts, each failure
+	// after that doubles the delay from BackoffBase up to BackoffMax
+	FreeAttempts int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// DefaultLoginGuardConfig returns the default configuration
+func DefaultLoginGuardConfig() LoginGuardConfig {
+	return LoginGuardConfig{
+		AccountThreshold: 10,
+		IPThreshold:      50,
+		LockoutDuration:  15 * time.Minute,
+		FreeAttempts:     3,
+		BackoffBase:      time.Second,
+		BackoffMax:       time.Minute,
+		Window:           15 * time.Minute,
+	}
+}
+
+// LoginGuard tracks failed logins per account and per IP address, slows down
+// repeated failures with exponential backoff and locks out after a threshold
+type LoginGuard struct {
+	repo  authRepository.LoginAttemptRepository
+	cfg   LoginGuardConfig
+	event *bus.EventBus
+	now   func() time.Time
+}
+
+// NewLoginGuard creates a new LoginGuard
+func NewLoginGuard(repo authRepository.LoginAttemptRepository, cfg LoginGuardConfig, event *bus.EventBus) *LoginGuard {
+	return &LoginGuard{
+		repo:  repo,
+		cfg:   cfg,
+		event: event,
+		now:   time.Now,
+	}
+}
+
+// Check returns a *LockedError when a login for email from ip must be refused
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	for _, target := range g.targets(email, ip) {
+		attempt, err := g.repo.Get(ctx, target.key)
+		if err != nil {
+			return err
+		}
+		if attempt == nil {
+			continue
+		}
+
+		if wait := g.retryAfter(attempt); wait > 0 {
+			return &LockedError{Scope: target.scope, RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login and locks out keys crossing their
+// threshold. Counters are updated atomically in the store, so failures
+// recorded by several instances sharing it are all counted.
+func (g *LoginGuard) RecordFailure(ctx context.Context, email, ip string) error {
+	now := g.now()
+	for _, target := range g.targets(email, ip) {
+		locked := false
+		attempt, err := g.repo.Update(ctx, target.key, func(current *authEntity.LoginAttempt) (*authEntity.LoginAttempt, time.Duration) {
+			// A lockout that has run out starts a fresh count
+			attempt := &authEntity.LoginAttempt{Key: target.key}
+			if current != nil && (current.LockedUntil.IsZero() || current.IsLocked(now)) {
+				*attempt = *current
+			}
+
+			attempt.Failures++
+			attempt.LastFailure = now
+
+			locked = false
+			if target.threshold > 0 && attempt.Failures >= target.threshold && !attempt.IsLocked(now) {
+				attempt.LockedUntil = now.Add(g.cfg.LockoutDuration)
+				locked = true
+			}
+
+			ttl := g.cfg.Window
+			if lockTTL := attempt.LockedUntil.Sub(now); lockTTL > ttl {
+				ttl = lockTTL
+			}
+			return attempt, ttl
+		})
+		if err != nil {
+			return err
+		}
+
+		if locked && g.event != nil {
+			bus.PublishContext(ctx, g.event, LockoutEvent{
+				Scope:       target.scope,
+				Subject:     target.subject,
+				Failures:    attempt.Failures,
+				LockedUntil: attempt.LockedUntil,
+			})
+		}
+	}
+	return nil
+}
+
+// RecordSuccess clears the failures of an account. IP counters are kept so a
+// valid login cannot be used to reset a credential stuffing run.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, email string) error {
+	return g.repo.Delete(ctx, accountKey(email))
+}
+
+// UnlockAccount clears the failures and lockout of an account
+func (g *LoginGuard) UnlockAccount(ctx context.Context, email string) error {
+	return g.repo.Delete(ctx, accountKey(email))
+}
+
+// UnlockIP clears the failures and lockout of an IP address
+func (g *LoginGuard) UnlockIP(ctx context.Context, ip string) error {
+	return g.repo.Delete(ctx, ipKey(ip))
+}
+
+// retryAfter returns how long a key must wait before its next attempt
+func (g *LoginGuard) retryAfter(attempt *authEntity.LoginAttempt) time.Duration {
+	now := g.now()
+	if attempt.IsLocked(now) {
+		return attempt.LockedUntil.Sub(now)
+	}
+
+	excess := attempt.Failures - g.cfg.FreeAttempts
+	if excess <= 0 || g.cfg.BackoffBase <= 0 {
+		return 0
+	}
+
+	delay := g.cfg.BackoffBase
+	for i := 1; i < excess && delay < g.cfg.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > g.cfg.BackoffMax {
+		delay = g.cfg.BackoffMax
+	}
+
+	return attempt.LastFailure.Add(delay).Sub(now)
+}
+
+type guardTarget struct {
+	scope     string
+	subject   string
+	key       string
+	threshold int
+}
+
+func (g *LoginGuard) targets(email, ip string) []guardTarget {
+	targets := []guardTarget{{ScopeAccount, normalizeEmail(email), accountKey(email), g.cfg.AccountThreshold}}
+	if ip != "" {
+		targets = append(targets, guardTarget{ScopeIP, ip, ipKey(ip), g.cfg.IPThreshold})
+	}
+	return targets
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func accountKey(email string) string {
+	return "login:account:" + normalizeEmail(email)
+}
+
+func ipKey(ip string) string {
+	return "login:ip:" + ip
+}
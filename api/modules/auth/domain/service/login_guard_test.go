@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/cache"
+	"nanonime/internal/pkg/database"
+	authEntity "nanonime/modules/auth/domain/entity"
+	authRepository "nanonime/modules/auth/domain/repository"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestGuard(event *bus.EventBus) (*LoginGuard, *time.Time) {
+	cfg := LoginGuardConfig{
+		AccountThreshold: 5,
+		IPThreshold:      8,
+		LockoutDuration:  10 * time.Minute,
+		FreeAttempts:     2,
+		BackoffBase:      time.Second,
+		BackoffMax:       4 * time.Second,
+		Window:           15 * time.Minute,
+	}
+	guard := NewLoginGuard(authRepository.NewLoginAttemptMemoryRepository(time.Hour), cfg, event)
+
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+func TestLoginGuardBackoffAndLockout(t *testing.T) {
+	ctx := context.Background()
+	event := bus.NewEventBus()
+	defer event.Close()
+
+	var lockouts []LockoutEvent
+	event.SubscribeFunc(EventLockout, func(e bus.Event) {
+		lockouts = append(lockouts, e.Payload.(LockoutEvent))
+	})
+
+	guard, now := newTestGuard(event)
+
+	// Free attempts are not delayed
+	for i := 0; i < 2; i++ {
+		guard.RecordFailure(ctx, "User@Example.com", "10.0.0.1")
+		if err := guard.Check(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d unexpectedly refused: %v", i+1, err)
+		}
+	}
+
+	// Backoff doubles and is capped
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		guard.RecordFailure(ctx, "user@example.com", "10.0.0.1")
+		err := guard.Check(ctx, "user@example.com", "10.0.0.1")
+		locked, ok := err.(*LockedError)
+		if i == 2 {
+			// The fifth failure crosses the account threshold
+			if !ok || locked.Scope != ScopeAccount || locked.RetryAfter != 10*time.Minute {
+				t.Fatalf("expected account lockout, got %v", err)
+			}
+			break
+		}
+		if !ok || locked.RetryAfter != want {
+			t.Fatalf("expected backoff of %s, got %v", want, err)
+		}
+		*now = now.Add(want)
+	}
+
+	event.Wait()
+	if len(lockouts) != 1 || lockouts[0].Subject != "user@example.com" {
+		t.Fatalf("expected one lockout event, got %+v", lockouts)
+	}
+
+	// Other accounts from another address are unaffected
+	if err := guard.Check(ctx, "other@example.com", "10.0.0.2"); err != nil {
+		t.Fatalf("unrelated login refused: %v", err)
+	}
+
+	if err := guard.UnlockAccount(ctx, "USER@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Check(ctx, "user@example.com", "10.0.0.2"); err != nil {
+		t.Fatalf("login refused after unlock: %v", err)
+	}
+}
+
+func TestLoginGuardIPLockout(t *testing.T) {
+	ctx := context.Background()
+	guard, _ := newTestGuard(nil)
+	guard.cfg.FreeAttempts = 100
+
+	// Spraying many accounts from one address locks the address
+	for i := 0; i < 8; i++ {
+		guard.RecordFailure(ctx, string(rune('a'+i))+"@example.com", "10.0.0.9")
+	}
+
+	err := guard.Check(ctx, "fresh@example.com", "10.0.0.9")
+	if locked, ok := err.(*LockedError); !ok || locked.Scope != ScopeIP {
+		t.Fatalf("expected ip lockout, got %v", err)
+	}
+
+	// A successful login does not clear the address
+	guard.RecordSuccess(ctx, "fresh@example.com")
+	if err := guard.Check(ctx, "fresh@example.com", "10.0.0.9"); err == nil {
+		t.Fatal("ip lockout cleared by a successful login")
+	}
+}
+
+// sharedRepositories returns the stores shared by several instances
+func sharedRepositories(t *testing.T) map[string]authRepository.LoginAttemptRepository {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&authEntity.LoginAttempt{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+
+	redisStore, err := cache.NewRedisStore("redis://"+miniredis.RunT(t).Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { redisStore.Close() })
+
+	return map[string]authRepository.LoginAttemptRepository{
+		"database": authRepository.NewLoginAttemptRepositoryImpl(),
+		"redis":    authRepository.NewLoginAttemptCacheRepository(redisStore),
+	}
+}
+
+func TestLoginGuardCountsFailuresOfEveryInstance(t *testing.T) {
+	ctx := context.Background()
+
+	for name, repo := range sharedRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			cfg := DefaultLoginGuardConfig()
+			cfg.AccountThreshold = 40
+
+			// Two instances of the API sharing the store
+			guards := []*LoginGuard{NewLoginGuard(repo, cfg, nil), NewLoginGuard(repo, cfg, nil)}
+
+			var wg sync.WaitGroup
+			for _, guard := range guards {
+				for i := 0; i < 5; i++ {
+					wg.Add(1)
+					go func(guard *LoginGuard) {
+						defer wg.Done()
+						for j := 0; j < 5; j++ {
+							if err := guard.RecordFailure(ctx, "user@example.com", ""); err != nil {
+								t.Error(err)
+							}
+						}
+					}(guard)
+				}
+			}
+			wg.Wait()
+
+			attempt, err := repo.Get(ctx, accountKey("user@example.com"))
+			if err != nil || attempt == nil || attempt.Failures != 50 {
+				t.Fatalf("expected 50 failures, got %+v err=%v", attempt, err)
+			}
+			if !attempt.IsLocked(time.Now()) {
+				t.Errorf("expected the account to be locked out")
+			}
+		})
+	}
+}
+
+func TestDeleteExpiredLoginAttempts(t *testing.T) {
+	ctx := context.Background()
+	repo := sharedRepositories(t)["database"].(authRepository.LoginAttemptRepositoryImpl)
+
+	expired := authEntity.LoginAttempt{Key: "login:ip:198.51.100.1", Failures: 1, ExpiresAt: time.Now().Add(-time.Minute)}
+	active := authEntity.LoginAttempt{Key: "login:ip:198.51.100.2", Failures: 1, ExpiresAt: time.Now().Add(time.Minute)}
+	if err := database.DB.Create([]authEntity.LoginAttempt{expired, active}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := repo.DeleteExpired(ctx)
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected 1 expired attempt deleted, got %d err=%v", deleted, err)
+	}
+	if attempt, err := repo.Get(ctx, active.Key); err != nil || attempt == nil {
+		t.Errorf("expected the active attempt to be kept, got %+v err=%v", attempt, err)
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"nanonime/internal/pkg/cache"
+	"time"
+)
+
+// TokenDenylist keeps the ids of revoked access tokens in a cache store until
+// the tokens expire. With a shared store every replica rejects them.
+type TokenDenylist struct {
+	store cache.Store
+}
+
+// NewTokenDenylist creates a denylist kept in store
+func NewTokenDenylist(store cache.Store) *TokenDenylist {
+	return &TokenDenylist{store: store}
+}
+
+// Revoke denies the access token with tokenID until expiresAt
+func (d *TokenDenylist) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if tokenID == "" || ttl <= 0 {
+		return nil
+	}
+	return d.store.Set(ctx, d.key(tokenID), []byte{1}, ttl)
+}
+
+// IsRevoked implements middleware.TokenDenylist
+func (d *TokenDenylist) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+	_, found, err := d.store.Get(ctx, d.key(tokenID))
+	return found, err
+}
+
+func (d *TokenDenylist) key(tokenID string) string {
+	return "auth:revoked_token:" + tokenID
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"nanonime/internal/contract/users"
+	"nanonime/internal/pkg/jwt"
+	authEntity "nanonime/modules/auth/domain/entity"
+	authRepository "nanonime/modules/auth/domain/repository"
+	"time"
+)
+
+// Errors
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// TokenPair is a short-lived access token and the refresh token used to renew it
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// SessionInfo describes the client a refresh token is issued to
+type SessionInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// TokenService issues, rotates and revokes tokens. Revoking a session also
+// denies the access tokens issued for it that have not expired yet.
+type TokenService struct {
+	userRepo   authRepository.UserRepository
+	tokenRepo  authRepository.RefreshTokenRepository
+	denylist   *TokenDenylist
+	jwt        jwt.JWT
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewTokenService creates a new TokenService
+func NewTokenService(userRepo authRepository.UserRepository, tokenRepo authRepository.RefreshTokenRepository, denylist *TokenDenylist, jwt jwt.JWT, accessTTL, refreshTTL time.Duration) *TokenService {
+	return &TokenService{
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		denylist:   denylist,
+		jwt:        jwt,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// IssueTokens starts a new session for user
+func (s *TokenService) IssueTokens(ctx context.Context, user *users.Account, session SessionInfo) (*TokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, user, familyID, session)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token
+// is revoked; presenting an already revoked token revokes its whole family,
+// since it means the token was stolen or replayed.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string, session SessionInfo) (*TokenPair, error) {
+	token, err := s.find(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.IsRevoked() {
+		if err := s.revokeFamily(ctx, token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if token.IsExpired(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	rotated, err := s.tokenRepo.Revoke(ctx, token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Lost a race with another refresh of the same token
+		if err := s.revokeFamily(ctx, token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	user, err := s.userRepo.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issue(ctx, user, token.FamilyID, session)
+}
+
+// Revoke revokes the session a refresh token belongs to
+func (s *TokenService) Revoke(ctx context.Context, refreshToken string) error {
+	token, err := s.find(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	return s.revokeFamily(ctx, token.FamilyID)
+}
+
+// RevokeAllForUser revokes every session of a user
+func (s *TokenService) RevokeAllForUser(ctx context.Context, userID uint) error {
+	if err := s.tokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.RevokeAccessTokens(ctx, userID)
+}
+
+// RevokeAccessTokens denies the unexpired access tokens of a user, their
+// sessions stay valid so refreshing issues tokens with the user's current
+// claims
+func (s *TokenService) RevokeAccessTokens(ctx context.Context, userID uint) error {
+	tokens, err := s.tokenRepo.FindUserIssuedSince(ctx, userID, time.Now().Add(-s.accessTTL))
+	if err != nil {
+		return err
+	}
+	return s.deny(ctx, tokens)
+}
+
+// revokeFamily revokes a session and denies its unexpired access tokens
+func (s *TokenService) revokeFamily(ctx context.Context, familyID string) error {
+	if err := s.tokenRepo.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	tokens, err := s.tokenRepo.FindFamilyIssuedSince(ctx, familyID, time.Now().Add(-s.accessTTL))
+	if err != nil {
+		return err
+	}
+	return s.deny(ctx, tokens)
+}
+
+// deny adds the access tokens issued with tokens to the denylist until they
+// expire
+func (s *TokenService) deny(ctx context.Context, tokens []*authEntity.RefreshToken) error {
+	for _, token := range tokens {
+		if err := s.denylist.Revoke(ctx, token.AccessTokenID, token.CreatedAt.Add(s.accessTTL)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TokenService) find(ctx context.Context, refreshToken string) (*authEntity.RefreshToken, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	token, err := s.tokenRepo.FindByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if err == authRepository.ERR_RECORD_NOT_FOUND {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *TokenService) issue(ctx context.Context, user *users.Account, familyID string, session SessionInfo) (*TokenPair, error) {
+	accessTokenID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	accessToken, err := s.jwt.GenerateToken(jwt.Claims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      user.Role,
+		TokenID:   accessTokenID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(s.accessTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tokenRepo.Create(ctx, &authEntity.RefreshToken{
+		UserID:        user.ID,
+		FamilyID:      familyID,
+		TokenHash:     hashToken(refreshToken),
+		AccessTokenID: accessTokenID,
+		UserAgent:     truncate(session.UserAgent, 255),
+		IPAddress:     truncate(session.IPAddress, 64),
+		ExpiresAt:     now.Add(s.refreshTTL),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.accessTTL,
+	}, nil
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 of token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
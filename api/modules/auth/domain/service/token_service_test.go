@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"nanonime/internal/contract/users"
+	"nanonime/internal/pkg/cache"
+	"nanonime/internal/pkg/database"
+	"nanonime/internal/pkg/jwt"
+	authEntity "nanonime/modules/auth/domain/entity"
+	authRepository "nanonime/modules/auth/domain/repository"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB points the repositories at an empty in-memory database
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&authEntity.RefreshToken{}, &authEntity.UserToken{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+	return db
+}
+
+// memoryUsers keeps accounts and password hashes in memory
+type memoryUsers struct {
+	authRepository.UserRepository
+	accounts  map[uint]*users.Account
+	passwords map[uint]string
+}
+
+func newMemoryUsers(accounts ...users.Account) *memoryUsers {
+	r := &memoryUsers{accounts: map[uint]*users.Account{}, passwords: map[uint]string{}}
+	for _, account := range accounts {
+		account := account
+		r.accounts[account.ID] = &account
+	}
+	return r
+}
+
+func (r *memoryUsers) FindByID(ctx context.Context, id uint) (*users.Account, error) {
+	account, ok := r.accounts[id]
+	if !ok {
+		return nil, authRepository.ERR_RECORD_NOT_FOUND
+	}
+	copy := *account
+	return &copy, nil
+}
+
+func (r *memoryUsers) FindByEmail(ctx context.Context, email string) (*users.Account, error) {
+	for id, account := range r.accounts {
+		if account.Email == email {
+			return r.FindByID(ctx, id)
+		}
+	}
+	return nil, authRepository.ERR_RECORD_NOT_FOUND
+}
+
+func (r *memoryUsers) SetPassword(ctx context.Context, id uint, passwordHash string) (*users.Account, error) {
+	if _, ok := r.accounts[id]; !ok {
+		return nil, authRepository.ERR_RECORD_NOT_FOUND
+	}
+	r.passwords[id] = passwordHash
+	return r.FindByID(ctx, id)
+}
+
+func (r *memoryUsers) VerifyEmail(ctx context.Context, id uint) (*users.Account, error) {
+	account, ok := r.accounts[id]
+	if !ok {
+		return nil, authRepository.ERR_RECORD_NOT_FOUND
+	}
+	if account.EmailVerifiedAt == nil {
+		now := time.Now()
+		account.EmailVerifiedAt = &now
+	}
+	return r.FindByID(ctx, id)
+}
+
+type tokenFixture struct {
+	service  *TokenService
+	denylist *TokenDenylist
+	jwt      jwt.JWT
+	users    *memoryUsers
+}
+
+func newTokenFixture(t *testing.T) *tokenFixture {
+	t.Helper()
+	useTestDB(t)
+
+	f := &tokenFixture{
+		denylist: NewTokenDenylist(cache.NewMemoryStore(time.Minute)),
+		jwt:      jwt.NewJWTImpl("secret", 15*time.Minute),
+		users:    newMemoryUsers(users.Account{ID: 1, Email: "user@example.com", Role: users.RoleUser}),
+	}
+	f.service = NewTokenService(f.users, authRepository.NewRefreshTokenRepositoryImpl(), f.denylist, f.jwt, 15*time.Minute, time.Hour)
+	return f
+}
+
+// login starts a session of user 1
+func (f *tokenFixture) login(t *testing.T) *TokenPair {
+	t.Helper()
+	user, _ := f.users.FindByID(context.Background(), 1)
+	pair, err := f.service.IssueTokens(context.Background(), user, SessionInfo{UserAgent: "test", IPAddress: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+// revoked reports whether the denylist rejects the access token of pair
+func (f *tokenFixture) revoked(t *testing.T, pair *TokenPair) bool {
+	t.Helper()
+	claims, err := f.jwt.ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := f.denylist.IsRevoked(context.Background(), claims.TokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return revoked
+}
+
+func TestTokenServiceRotationAndReuse(t *testing.T) {
+	ctx := context.Background()
+	f := newTokenFixture(t)
+
+	first := f.login(t)
+	second, err := f.service.Refresh(ctx, first.RefreshToken, SessionInfo{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Fatal("expected refreshing to rotate both tokens")
+	}
+	if f.revoked(t, second) {
+		t.Fatal("expected the rotated access token to be accepted")
+	}
+
+	// Replaying the rotated token revokes the whole session
+	if _, err := f.service.Refresh(ctx, first.RefreshToken, SessionInfo{}); err != ErrRefreshTokenReused {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := f.service.Refresh(ctx, second.RefreshToken, SessionInfo{}); err != ErrRefreshTokenReused {
+		t.Fatalf("expected the current refresh token to be revoked, got %v", err)
+	}
+	if !f.revoked(t, first) || !f.revoked(t, second) {
+		t.Error("expected the access tokens of the session to be revoked")
+	}
+
+	if _, err := f.service.Refresh(ctx, "unknown", SessionInfo{}); err != ErrInvalidRefreshToken {
+		t.Errorf("expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestTokenServiceLogout(t *testing.T) {
+	ctx := context.Background()
+	f := newTokenFixture(t)
+
+	phone, laptop := f.login(t), f.login(t)
+
+	if err := f.service.Revoke(ctx, phone.RefreshToken); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if !f.revoked(t, phone) {
+		t.Error("expected the access token of the revoked session to be denied")
+	}
+	if f.revoked(t, laptop) {
+		t.Error("expected other sessions to be unaffected")
+	}
+	if _, err := f.service.Refresh(ctx, phone.RefreshToken, SessionInfo{}); err != ErrRefreshTokenReused {
+		t.Errorf("expected the revoked refresh token to be refused, got %v", err)
+	}
+
+	if err := f.service.RevokeAllForUser(ctx, 1); err != nil {
+		t.Fatalf("logout everywhere: %v", err)
+	}
+	if !f.revoked(t, laptop) {
+		t.Error("expected every access token of the user to be denied")
+	}
+	if _, err := f.service.Refresh(ctx, laptop.RefreshToken, SessionInfo{}); err == nil {
+		t.Error("expected every session of the user to be revoked")
+	}
+}
+
+func TestTokenServiceRevokeAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	f := newTokenFixture(t)
+
+	pair := f.login(t)
+	f.users.accounts[1].Role = users.RoleAdmin
+	if err := f.service.RevokeAccessTokens(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !f.revoked(t, pair) {
+		t.Fatal("expected the access token with the previous role to be denied")
+	}
+
+	// The session survives and the next access token carries the new role
+	refreshed, err := f.service.Refresh(ctx, pair.RefreshToken, SessionInfo{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	claims, err := f.jwt.ValidateToken(refreshed.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Role != users.RoleAdmin || f.revoked(t, refreshed) {
+		t.Errorf("expected a valid admin token, got %+v", claims)
+	}
+}
@@ -0,0 +1,47 @@
+package response
+
+import (
+	"nanonime/internal/contract/users"
+	"nanonime/modules/auth/domain/service"
+	"time"
+)
+
+// TokenResponse represents an issued token pair
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// FromTokenPair converts a token pair to a token response
+func FromTokenPair(pair *service.TokenPair) *TokenResponse {
+	return &TokenResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(pair.ExpiresIn.Seconds()),
+	}
+}
+
+// UserResponse represents the user of an auth response
+type UserResponse struct {
+	ID            uint      `json:"id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// FromAccount converts an account of the user module to a user response
+func FromAccount(user *users.Account) *UserResponse {
+	return &UserResponse{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Role:          user.Role,
+		CreatedAt:     user.CreatedAt,
+	}
+}
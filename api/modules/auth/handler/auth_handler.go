@@ -1,37 +1,47 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"nanonime/internal/contract/users"
 	"nanonime/internal/pkg/bus"
-	"nanonime/internal/pkg/jwt"
 	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/middleware"
 	"nanonime/internal/pkg/utils"
 	"nanonime/modules/auth/domain/service"
-	"nanonime/modules/users/domain/entity"
-	"nanonime/modules/users/dto/request"
-	"nanonime/modules/users/dto/response"
+	authRequest "nanonime/modules/auth/dto/request"
+	authResponse "nanonime/modules/auth/dto/response"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo"
 )
 
 // AuthHandler struct handles HTTP request for auth.
 type AuthHandler struct {
-	authService *service.AuthService
-	log         *logger.Logger
-	event       *bus.EventBus
-	jwt         jwt.JWT
-	r           *utils.Response
+	authService    *service.AuthService
+	tokenService   *service.TokenService
+	accountService *service.AccountService
+	loginGuard     *service.LoginGuard
+	resetLimiter   *middleware.RateLimiter
+	log            *logger.Logger
+	event          *bus.EventBus
+	r              *utils.Response
 }
 
-// NewAuthHandler creates a new auth handler.
-func NewAuthHandler(log *logger.Logger, event *bus.EventBus, authService *service.AuthService, jwt jwt.JWT) *AuthHandler {
+// NewAuthHandler creates a new auth handler. resetLimiter limits the password
+// reset requests of each client.
+func NewAuthHandler(log *logger.Logger, event *bus.EventBus, authService *service.AuthService, tokenService *service.TokenService, accountService *service.AccountService, loginGuard *service.LoginGuard, resetLimiter *middleware.RateLimiter) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		log:         log,
-		event:       event,
-		jwt:         jwt,
-		r:           &utils.Response{},
+		authService:    authService,
+		tokenService:   tokenService,
+		accountService: accountService,
+		loginGuard:     loginGuard,
+		resetLimiter:   resetLimiter,
+		log:            log,
+		event:          event,
+		r:              &utils.Response{},
 	}
 }
 
@@ -40,11 +50,54 @@ func (h *AuthHandler) Handle(event bus.Event) {
 	fmt.Printf("User created: %v", event.Payload)
 }
 
+// HandleUserCreated sends the verification email to a new user. Failures are
+// returned so a persistent bus retries the mail.
+func (h *AuthHandler) HandleUserCreated(e users.UserCreated) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := h.accountService.ResendEmailVerification(ctx, e.ID)
+	switch err {
+	case nil, service.ErrEmailAlreadyVerified, service.ErrUserNotFound:
+		return nil
+	}
+	h.log.Error("Failed to send verification email:", err)
+	return err
+}
+
+// HandlePasswordResetRequested mails a password reset link. Failures are
+// returned so a persistent bus retries the mail.
+func (h *AuthHandler) HandlePasswordResetRequested(e service.PasswordResetRequested) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := h.accountService.SendPasswordReset(ctx, e.Email); err != nil {
+		h.log.Error("Failed to send password reset email:", err)
+		return err
+	}
+	return nil
+}
+
+// HandleUserDeleted revokes the sessions of a deleted user.
+func (h *AuthHandler) HandleUserDeleted(e users.UserDeleted) {
+	if err := h.tokenService.RevokeAllForUser(context.Background(), e.ID); err != nil {
+		h.log.Error("Failed to revoke sessions of deleted user:", err)
+	}
+}
+
+// HandleUserRoleChanged revokes the access tokens carrying the previous role,
+// the user's sessions stay valid and refreshing picks up the new role.
+func (h *AuthHandler) HandleUserRoleChanged(e users.UserRoleChanged) {
+	if err := h.tokenService.RevokeAccessTokens(context.Background(), e.ID); err != nil {
+		h.log.Error("Failed to revoke access tokens after role change:", err)
+	}
+}
+
 // Register handles user registration.
 func (h *AuthHandler) Register(c echo.Context) error {
 	h.log.Info("Handling register request")
 
-	req := new(request.CreateUserRequest)
+	req := new(authRequest.RegisterRequest)
 	if err := c.Bind(req); err != nil {
 		h.log.Error("Failed to bind request:", err)
 		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
@@ -57,8 +110,7 @@ func (h *AuthHandler) Register(c echo.Context) error {
 
 	h.log.Debug("Request validated successfully:", req)
 
-	user := entity.NewUser(req.Name, req.Email, req.Password)
-	err := h.authService.CreateUser(c.Request().Context(), user)
+	user, err := h.authService.CreateUser(c.Request().Context(), req.Name, req.Email, req.Password)
 	if err != nil {
 		if err == service.ErrEmailAlreadyUsed {
 			h.log.Warn("Email already in use:", req.Email)
@@ -68,13 +120,10 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		return h.r.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 	}
 
-	h.log.Debug("User created successfully:", user)
-
-	h.event.Publish(bus.Event{Type: "user.created", Payload: user})
-	h.log.Debug("Event 'user.created' published successfully")
+	h.log.Debug("User created successfully", "user_id", user.ID)
 
 	return h.r.SuccessResponse(c, map[string]interface{}{
-		"user": response.FromEntity(user),
+		"user": authResponse.FromAccount(user),
 	}, "User registered successfully")
 }
 
@@ -82,7 +131,7 @@ func (h *AuthHandler) Register(c echo.Context) error {
 func (h *AuthHandler) Login(c echo.Context) error {
 	h.log.Info("Handling login request")
 
-	req := new(request.LoginRequest)
+	req := new(authRequest.LoginRequest)
 	if err := c.Bind(req); err != nil {
 		h.log.Error("Failed to bind request:", err)
 		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
@@ -93,41 +142,300 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
 
-	h.log.Debug("Request validated successfully:", req)
+	ctx := c.Request().Context()
+	ip := middleware.ClientIP(c)
 
-	user, err := h.authService.ProcessLogin(c.Request().Context(), req.Email, req.Password)
+	if err := h.loginGuard.Check(ctx, req.Email, ip); err != nil {
+		if locked, ok := err.(*service.LockedError); ok {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+			return h.r.CustomResponse(c, http.StatusTooManyRequests, nil, "", "Too many failed login attempts, try again later")
+		}
+		h.log.Error("Failed to check login attempts:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	user, err := h.authService.ProcessLogin(ctx, req.Email, req.Password)
 	if err != nil {
 		if err == service.ErrUserNotFound || err == service.ErrInvalidPassword {
-			h.log.Warn("Invalid email or password for:", req.Email)
+			h.log.Warn("Invalid email or password", "ip", ip)
+			if err := h.loginGuard.RecordFailure(ctx, req.Email, ip); err != nil {
+				h.log.Error("Failed to record login failure:", err)
+			}
 			return h.r.ErrorResponse(c, http.StatusUnauthorized, "Invalid email or password")
 		}
+		if err == service.ErrEmailNotVerified {
+			return h.r.ForbiddenResponse(c, "Email address not verified")
+		}
 		h.log.Error("Failed to process login:", err)
 		return h.r.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 	}
 
-	h.log.Debug("User authenticated successfully:", user)
-
-	tokenData := map[string]interface{}{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"name":    user.Name,
+	if err := h.loginGuard.RecordSuccess(ctx, req.Email); err != nil {
+		h.log.Error("Failed to reset login attempts:", err)
 	}
 
-	token, err := h.jwt.GenerateToken(tokenData)
+	h.log.Debug("User authenticated successfully", "user_id", user.ID)
+
+	tokens, err := h.tokenService.IssueTokens(c.Request().Context(), user, sessionInfo(c))
 	if err != nil {
 		h.log.Error("Failed to generate token:", err)
 		return h.r.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 	}
 
+	data := authResponse.FromTokenPair(tokens)
 	return h.r.SuccessResponse(c, map[string]interface{}{
-		"token": token,
-		"user":  response.FromEntity(user),
+		"token":         data.Token,
+		"refresh_token": data.RefreshToken,
+		"token_type":    data.TokenType,
+		"expires_in":    data.ExpiresIn,
+		"user":          authResponse.FromAccount(user),
 	}, "Login successful")
 }
 
+// Refresh rotates a refresh token and issues a new token pair.
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	req := new(authRequest.RefreshTokenRequest)
+	if err := c.Bind(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	tokens, err := h.tokenService.Refresh(c.Request().Context(), req.RefreshToken, sessionInfo(c))
+	if err != nil {
+		if err == service.ErrRefreshTokenReused {
+			h.log.Warn("Refresh token reuse detected, session revoked")
+			return h.r.UnauthorizedResponse(c, "Refresh token has already been used")
+		}
+		if err == service.ErrInvalidRefreshToken {
+			return h.r.UnauthorizedResponse(c, "Invalid refresh token")
+		}
+		h.log.Error("Failed to refresh token:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	return h.r.SuccessResponse(c, authResponse.FromTokenPair(tokens), "Token refreshed")
+}
+
+// Logout revokes the session of the given refresh token.
+func (h *AuthHandler) Logout(c echo.Context) error {
+	req := new(authRequest.RefreshTokenRequest)
+	if err := c.Bind(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.tokenService.Revoke(c.Request().Context(), req.RefreshToken); err != nil {
+		if err == service.ErrInvalidRefreshToken {
+			return h.r.UnauthorizedResponse(c, "Invalid refresh token")
+		}
+		h.log.Error("Failed to revoke token:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	return h.r.SuccessResponse(c, nil, "Logged out")
+}
+
+// LogoutAll revokes every session of the authenticated user.
+func (h *AuthHandler) LogoutAll(c echo.Context) error {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		return h.r.UnauthorizedResponse(c, "Unauthorized")
+	}
+
+	if err := h.tokenService.RevokeAllForUser(c.Request().Context(), principal.UserID); err != nil {
+		h.log.Error("Failed to revoke tokens:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	return h.r.SuccessResponse(c, nil, "Logged out from all devices")
+}
+
+// ChangePassword changes the password of the authenticated user. Every other
+// session is revoked and a new token pair is issued for the current one.
+func (h *AuthHandler) ChangePassword(c echo.Context) error {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		return h.r.UnauthorizedResponse(c, "Unauthorized")
+	}
+
+	req := new(authRequest.ChangePasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	user, err := h.authService.ChangePassword(ctx, principal.UserID, req.OldPassword, req.Password)
+	if err != nil {
+		if err == service.ErrInvalidPassword {
+			return h.r.ForbiddenResponse(c, "Current password is incorrect")
+		}
+		if err == service.ErrUserNotFound {
+			return h.r.NotFoundResponse(c, "User not found")
+		}
+		h.log.Error("Failed to change password:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	if err := h.tokenService.RevokeAllForUser(ctx, user.ID); err != nil {
+		h.log.Error("Failed to revoke tokens:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	tokens, err := h.tokenService.IssueTokens(ctx, user, sessionInfo(c))
+	if err != nil {
+		h.log.Error("Failed to generate token:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	return h.r.SuccessResponse(c, authResponse.FromTokenPair(tokens), "Password changed")
+}
+
+// RequestEmailVerification sends a new verification email to the
+// authenticated user.
+func (h *AuthHandler) RequestEmailVerification(c echo.Context) error {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		return h.r.UnauthorizedResponse(c, "Unauthorized")
+	}
+
+	if err := h.accountService.ResendEmailVerification(c.Request().Context(), principal.UserID); err != nil {
+		if err == service.ErrEmailAlreadyVerified {
+			return h.r.ConflictResponse(c, "Email already verified")
+		}
+		if err == service.ErrUserNotFound {
+			return h.r.NotFoundResponse(c, "User not found")
+		}
+		h.log.Error("Failed to send verification email:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	return h.r.SuccessResponse(c, nil, "Verification email sent")
+}
+
+// ConfirmEmail verifies an email address with the token from the
+// verification email.
+func (h *AuthHandler) ConfirmEmail(c echo.Context) error {
+	req := new(authRequest.TokenRequest)
+	if err := c.Bind(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	user, err := h.accountService.ConfirmEmail(c.Request().Context(), req.Token)
+	if err != nil {
+		if err == service.ErrInvalidUserToken {
+			return h.r.BadRequestResponse(c, "Invalid or expired token")
+		}
+		h.log.Error("Failed to confirm email:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	return h.r.SuccessResponse(c, map[string]interface{}{
+		"user": authResponse.FromAccount(user),
+	}, "Email verified")
+}
+
+// ForgotPassword sends a password reset email in the background. The response
+// does not reveal whether the address belongs to an account.
+func (h *AuthHandler) ForgotPassword(c echo.Context) error {
+	req := new(authRequest.ForgotPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	h.accountService.RequestPasswordReset(c.Request().Context(), req.Email)
+
+	return h.r.SuccessResponse(c, nil, "If the address belongs to an account, a password reset email has been sent")
+}
+
+// ResetPassword sets a new password with the token from the password reset
+// email and revokes every session.
+func (h *AuthHandler) ResetPassword(c echo.Context) error {
+	req := new(authRequest.ResetPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(req); err != nil {
+		return h.r.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := h.accountService.ResetPassword(c.Request().Context(), req.Token, req.Password); err != nil {
+		if err == service.ErrInvalidUserToken {
+			return h.r.BadRequestResponse(c, "Invalid or expired token")
+		}
+		h.log.Error("Failed to reset password:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	return h.r.SuccessResponse(c, nil, "Password has been reset")
+}
+
+// Unlock clears the lockout of an account (?email=) or IP address (?ip=).
+func (h *AuthHandler) Unlock(c echo.Context) error {
+	ctx := c.Request().Context()
+	email, ip := c.QueryParam("email"), c.QueryParam("ip")
+	if email == "" && ip == "" {
+		return h.r.BadRequestResponse(c, "email or ip is required")
+	}
+
+	if email != "" {
+		if err := h.loginGuard.UnlockAccount(ctx, email); err != nil {
+			h.log.Error("Failed to unlock account:", err)
+			return h.r.InternalServerErrorResponse(c, err.Error())
+		}
+	}
+	if ip != "" {
+		if err := h.loginGuard.UnlockIP(ctx, ip); err != nil {
+			h.log.Error("Failed to unlock ip:", err)
+			return h.r.InternalServerErrorResponse(c, err.Error())
+		}
+	}
+
+	if principal, ok := middleware.GetPrincipal(c); ok {
+		h.log.Info("Login lockout cleared", "admin_id", principal.UserID, "ip", ip)
+	}
+
+	return h.r.SuccessResponse(c, nil, "Lockout cleared")
+}
+
+// sessionInfo describes the client making the request.
+func sessionInfo(c echo.Context) service.SessionInfo {
+	return service.SessionInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: middleware.ClientIP(c),
+	}
+}
+
 // RegisterRoutes sets up the auth routes.
 func (h *AuthHandler) RegisterRoutes(e *echo.Echo, basePath string) {
 	group := e.Group(basePath + "/auth")
 	group.POST("/register", h.Register)
 	group.POST("/login", h.Login)
+	group.POST("/refresh", h.Refresh)
+	group.POST("/logout", h.Logout)
+	group.POST("/logout-all", h.LogoutAll, middleware.Auth)
+	group.PUT("/password", h.ChangePassword, middleware.Auth)
+	group.POST("/password/forgot", h.ForgotPassword, h.resetLimiter.Middleware())
+	group.POST("/password/reset", h.ResetPassword)
+	group.POST("/email/verification", h.RequestEmailVerification, middleware.Auth)
+	group.POST("/email/verify", h.ConfirmEmail)
+	group.DELETE("/lockouts", h.Unlock, middleware.Auth, middleware.RequirePermission(PermAuthUnlock))
 }
@@ -0,0 +1,13 @@
+package handler
+
+import "nanonime/internal/pkg/rbac"
+
+// Permissions declared by the auth module
+const (
+	PermAuthUnlock rbac.Permission = "auth:unlock"
+)
+
+// Permissions returns every permission declared by the auth module
+func Permissions() []rbac.Permission {
+	return []rbac.Permission{PermAuthUnlock}
+}
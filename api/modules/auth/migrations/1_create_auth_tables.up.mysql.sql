@@ -0,0 +1,40 @@
+CREATE TABLE refresh_tokens (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    user_agent VARCHAR(255),
+    ip_address VARCHAR(64),
+    expires_at DATETIME(3) NULL,
+    revoked_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_refresh_tokens_user_id (user_id),
+    INDEX idx_refresh_tokens_family_id (family_id),
+    UNIQUE INDEX idx_refresh_tokens_token_hash (token_hash)
+);
+
+CREATE TABLE user_tokens (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at DATETIME(3) NULL,
+    used_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_user_tokens_user_id (user_id),
+    INDEX idx_user_tokens_purpose (purpose),
+    UNIQUE INDEX idx_user_tokens_token_hash (token_hash)
+);
+
+CREATE TABLE login_attempts (
+    attempt_key VARCHAR(191) NOT NULL,
+    failures BIGINT,
+    last_failure DATETIME(3) NULL,
+    locked_until DATETIME(3) NULL,
+    expires_at DATETIME(3) NULL,
+    PRIMARY KEY (attempt_key),
+    INDEX idx_login_attempts_expires_at (expires_at)
+);
@@ -0,0 +1,38 @@
+-- Other drivers, e.g. sqlite in tests
+CREATE TABLE refresh_tokens (
+    id INTEGER PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    user_agent VARCHAR(255),
+    ip_address VARCHAR(64),
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+
+CREATE TABLE user_tokens (
+    id INTEGER PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at DATETIME,
+    used_at DATETIME,
+    created_at DATETIME
+);
+CREATE INDEX idx_user_tokens_user_id ON user_tokens (user_id);
+CREATE INDEX idx_user_tokens_purpose ON user_tokens (purpose);
+CREATE UNIQUE INDEX idx_user_tokens_token_hash ON user_tokens (token_hash);
+
+CREATE TABLE login_attempts (
+    attempt_key VARCHAR(191) PRIMARY KEY,
+    failures BIGINT,
+    last_failure DATETIME,
+    locked_until DATETIME,
+    expires_at DATETIME
+);
+CREATE INDEX idx_login_attempts_expires_at ON login_attempts (expires_at);
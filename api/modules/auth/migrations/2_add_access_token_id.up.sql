@@ -0,0 +1,3 @@
+-- id of the access token issued together with each refresh token, so the
+-- access tokens of a revoked session can be denied until they expire
+ALTER TABLE refresh_tokens ADD COLUMN access_token_id VARCHAR(64);
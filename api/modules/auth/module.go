@@ -1,45 +1,130 @@
 package auth
 
 import (
+	"context"
+	"embed"
+	"fmt"
+	"nanonime/internal/contract/users"
 	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/cache"
 	"nanonime/internal/pkg/config"
+	"nanonime/internal/pkg/jwt"
 	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/middleware"
+	"nanonime/internal/pkg/migrate"
+	"nanonime/internal/pkg/rbac"
+	authRepository "nanonime/modules/auth/domain/repository"
 	"nanonime/modules/auth/domain/service"
 	"nanonime/modules/auth/handler"
-	"nanonime/modules/users/domain/repository"
+	"net/http"
+	"time"
 
 	"github.com/labstack/echo"
 	"gorm.io/gorm"
 )
 
+// migrations are the SQL scripts of the module's schema, by driver
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
 type Module struct {
-	db          *gorm.DB
-	logger      *logger.Logger
-	authService *service.AuthService
-	authHandler *handler.AuthHandler
-	event       *bus.EventBus
+	cfg            *config.Config
+	settings       Config
+	db             *gorm.DB
+	logger         *logger.Logger
+	authService    *service.AuthService
+	tokenService   *service.TokenService
+	accountService *service.AccountService
+	loginGuard     *service.LoginGuard
+	authHandler    *handler.AuthHandler
+	event          *bus.EventBus
+	cache          cache.Store
+	jwt            jwt.JWT
+
+	// stopPurge stops the purge of expired login attempts
+	stopPurge func()
 }
 
 func (m *Module) Name() string {
 	return "auth"
 }
 
+// Dependencies returns the modules the auth module relies on
+func (m *Module) Dependencies() []string {
+	return []string{"user"}
+}
+
+// Configure reads [jwt], [mail] and the module's [modules.auth] section
+func (m *Module) Configure(cfg *config.Config) error {
+	m.cfg = cfg
+	m.settings = DefaultConfig()
+	return cfg.Module(m.Name(), &m.settings)
+}
+
+// UseCache sets the application cache store, used for login attempts with
+// attempt_store = "cache"
+func (m *Module) UseCache(store cache.Store) {
+	m.cache = store
+}
+
 func (m *Module) Initialize(db *gorm.DB, log *logger.Logger, event *bus.EventBus) error {
 	m.db = db
 	m.logger = log
 	m.event = event
 
 	// Initialize repositories
-	userRepo := repository.NewUserRepositoryImpl()
+	userRepo := authRepository.NewUserRepositoryImpl(m.event)
+	tokenRepo := authRepository.NewRefreshTokenRepositoryImpl()
+	userTokenRepo := authRepository.NewUserTokenRepositoryImpl()
+
+	// Initialize JWT
+	jwtService, err := m.cfg.JWT.Service()
+	if err != nil {
+		return err
+	}
+	m.jwt = jwtService
+
+	// Initialize mailer
+	mail, err := m.cfg.Mail.Mailer(m.logger)
+	if err != nil {
+		return err
+	}
 
 	// Initialize services
 	m.authService = service.NewAuthService(userRepo)
-
-	// Initialize JWT
-	jwtService := config.GetJWTService()
+	m.authService.SetRequireVerifiedEmail(m.cfg.Feature(FeatureRequireVerifiedEmail))
+	// Revoked access tokens are denied by every replica sharing the cache
+	store := m.cache
+	if store == nil {
+		store = cache.NewMemoryStore(time.Minute)
+	}
+	denylist := service.NewTokenDenylist(store)
+	middleware.UseTokenDenylist(denylist)
+	m.tokenService = service.NewTokenService(userRepo, tokenRepo, denylist, jwtService, m.cfg.JWT.AccessTokenTTL(), m.cfg.JWT.RefreshTokenTTL())
+	var attempts authRepository.LoginAttemptRepository
+	m.loginGuard, attempts, err = newLoginGuard(m.settings, m.event, m.cache)
+	if err != nil {
+		return err
+	}
+	if purger, ok := attempts.(expiredAttemptPurger); ok {
+		m.stopPurge = m.purgeLoginAttempts(purger, time.Duration(m.settings.AttemptWindowMinutes)*time.Minute)
+	}
+	m.accountService = service.NewAccountService(m.event, userRepo, userTokenRepo, m.tokenService, mail, m.cfg.Mail.BaseURL)
 
 	// Initialize handlers
-	m.authHandler = handler.NewAuthHandler(m.logger, m.event, m.authService, jwtService)
+	resetLimiter := middleware.NewRateLimiter(float64(m.settings.PasswordResetsPerHour)/3600, m.settings.PasswordResetsPerHour)
+	m.authHandler = handler.NewAuthHandler(m.logger, m.event, m.authService, m.tokenService, m.accountService, m.loginGuard, resetLimiter)
+
+	// Declare permissions
+	rbac.Default.Grant(users.RoleAdmin, handler.Permissions()...)
+
+	// register event listeners
+	// mail delivery may be slow, so verification mails get their own workers
+	bus.SubscribeErr(m.event, m.authHandler.HandleUserCreated, bus.WithLogger(m.logger), bus.WithWorkers(4), bus.WithTimeout(time.Minute))
+	bus.SubscribeErr(m.event, m.authHandler.HandlePasswordResetRequested, bus.WithLogger(m.logger), bus.WithWorkers(4), bus.WithTimeout(time.Minute))
+	bus.Subscribe(m.event, m.authHandler.HandleUserDeleted, bus.WithLogger(m.logger))
+	bus.Subscribe(m.event, m.authHandler.HandleUserRoleChanged, bus.WithLogger(m.logger))
 
 	m.logger.Info("Auth module initialized successfully")
 	return nil
@@ -51,16 +136,107 @@ func (m *Module) RegisterRoutes(e *echo.Echo, basePath string) {
 		return
 	}
 	m.authHandler.RegisterRoutes(e, basePath)
+
+	// Public keys are served at the well-known location, outside the API
+	// version prefix, so other services can verify our tokens
+	e.GET("/.well-known/jwks.json", func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "public, max-age=300")
+		return c.JSON(http.StatusOK, m.jwt.JWKS())
+	})
+}
+
+// Migrations returns the module's migrations
+func (m *Module) Migrations() []migrate.Migration {
+	return migrate.MustFromFS(migrations, "migrations")
+}
+
+// Reload applies the feature flags of the module
+func (m *Module) Reload(cfg *config.Config, changed []string) {
+	m.authService.SetRequireVerifiedEmail(cfg.Feature(FeatureRequireVerifiedEmail))
 }
 
-func (m *Module) Migrations() error {
+// Stop stops the purge of expired login attempts
+func (m *Module) Stop(ctx context.Context) error {
+	if m.stopPurge != nil {
+		m.stopPurge()
+	}
 	return nil
 }
 
+// expiredAttemptPurger is implemented by login attempt stores that do not
+// expire records by themselves
+type expiredAttemptPurger interface {
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// purgeLoginAttempts deletes expired login attempts every interval, the
+// returned function stops it and waits for a running purge
+func (m *Module) purgeLoginAttempts(purger expiredAttemptPurger, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := purger.DeleteExpired(ctx)
+				if err != nil && ctx.Err() == nil {
+					m.logger.Error("Failed to purge expired login attempts: %v", err)
+				} else if deleted > 0 {
+					m.logger.Debug("Purged expired login attempts", "count", deleted)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
 func (m *Module) Logger() *logger.Logger {
 	return m.logger
 }
 
+// newLoginGuard builds the brute-force protection from [modules.auth]
+func newLoginGuard(auth Config, event *bus.EventBus, cache cache.Store) (*service.LoginGuard, authRepository.LoginAttemptRepository, error) {
+	cfg := service.DefaultLoginGuardConfig()
+	cfg.AccountThreshold = auth.LockoutThreshold
+	cfg.IPThreshold = auth.IPLockoutThreshold
+	cfg.LockoutDuration = time.Duration(auth.LockoutMinutes) * time.Minute
+	cfg.FreeAttempts = auth.BackoffFreeAttempts
+	cfg.BackoffBase = time.Duration(auth.BackoffBaseSeconds) * time.Second
+	cfg.BackoffMax = time.Duration(auth.BackoffMaxSeconds) * time.Second
+	cfg.Window = time.Duration(auth.AttemptWindowMinutes) * time.Minute
+
+	var repo authRepository.LoginAttemptRepository
+	switch store := auth.AttemptStore; store {
+	case "memory":
+		retention := cfg.Window
+		if cfg.LockoutDuration > retention {
+			retention = cfg.LockoutDuration
+		}
+		repo = authRepository.NewLoginAttemptMemoryRepository(retention)
+	case "cache":
+		if cache == nil {
+			return nil, nil, fmt.Errorf("attempt_store %q requires the application cache", store)
+		}
+		repo = authRepository.NewLoginAttemptCacheRepository(cache)
+	case "database":
+		repo = authRepository.NewLoginAttemptRepositoryImpl()
+	default:
+		return nil, nil, fmt.Errorf("unsupported attempt_store %q", store)
+	}
+
+	return service.NewLoginGuard(repo, cfg, event), repo, nil
+}
+
 func NewModule() *Module {
 	return &Module{}
 }
@@ -0,0 +1,6 @@
+package request
+
+// PurgeRequest represents a request to purge cached responses by tag
+type PurgeRequest struct {
+	Tags []string `json:"tags" validate:"required,min=1,dive,required"`
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/middleware"
+	"nanonime/internal/pkg/utils"
+	"nanonime/modules/cache/dto/request"
+
+	"github.com/labstack/echo"
+)
+
+// CacheHandler handles HTTP requests for managing the response cache.
+type CacheHandler struct {
+	log *logger.Logger
+	r   *utils.Response
+}
+
+// NewCacheHandler creates a new cache handler.
+func NewCacheHandler(log *logger.Logger) *CacheHandler {
+	return &CacheHandler{
+		log: log,
+		r:   &utils.Response{},
+	}
+}
+
+// Purge drops the cached responses of every route tagged with one of the
+// requested tags.
+func (h *CacheHandler) Purge(c echo.Context) error {
+	req := new(request.PurgeRequest)
+	if err := c.Bind(req); err != nil {
+		return h.r.BadRequestResponse(c, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return h.r.BadRequestResponse(c, err.Error())
+	}
+
+	if err := middleware.PurgeCache(c.Request().Context(), req.Tags...); err != nil {
+		h.log.Error("Failed to purge cache", "tags", req.Tags, "error", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	if principal, ok := middleware.GetPrincipal(c); ok {
+		h.log.Info("Cache purged", "admin_id", principal.UserID, "tags", req.Tags)
+	}
+
+	return h.r.NoContentResponse(c)
+}
+
+// PurgeTag drops the cached responses of routes tagged with :tag.
+func (h *CacheHandler) PurgeTag(c echo.Context) error {
+	tag := c.Param("tag")
+	if err := middleware.PurgeCache(c.Request().Context(), tag); err != nil {
+		h.log.Error("Failed to purge cache", "tags", tag, "error", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	if principal, ok := middleware.GetPrincipal(c); ok {
+		h.log.Info("Cache purged", "admin_id", principal.UserID, "tags", tag)
+	}
+
+	return h.r.NoContentResponse(c)
+}
+
+// RegisterRoutes sets up the cache routes.
+func (h *CacheHandler) RegisterRoutes(e *echo.Echo, basePath string) {
+	group := e.Group(basePath+"/cache", middleware.Auth, middleware.RequirePermission(PermCachePurge))
+	group.POST("/purge", h.Purge)
+	group.DELETE("/tags/:tag", h.PurgeTag)
+}
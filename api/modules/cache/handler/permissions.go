@@ -0,0 +1,13 @@
+package handler
+
+import "nanonime/internal/pkg/rbac"
+
+// Permissions declared by the cache module
+const (
+	PermCachePurge rbac.Permission = "cache:purge"
+)
+
+// Permissions returns every permission declared by the cache module
+func Permissions() []rbac.Permission {
+	return []rbac.Permission{PermCachePurge}
+}
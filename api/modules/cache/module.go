@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"nanonime/internal/contract/users"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/migrate"
+	"nanonime/internal/pkg/rbac"
+	"nanonime/modules/cache/handler"
+
+	"github.com/labstack/echo"
+	"gorm.io/gorm"
+)
+
+// Module implements the application Module interface for the cache module,
+// which exposes admin endpoints for the HTTP response cache
+type Module struct {
+	logger       *logger.Logger
+	cacheHandler *handler.CacheHandler
+}
+
+// Name returns the name of the module
+func (m *Module) Name() string {
+	return "cache"
+}
+
+// Initialize initializes the module
+func (m *Module) Initialize(db *gorm.DB, log *logger.Logger, event *bus.EventBus) error {
+	m.logger = log
+
+	// Declare permissions, only admins may purge the cache
+	rbac.Default.Grant(users.RoleAdmin, handler.Permissions()...)
+
+	m.cacheHandler = handler.NewCacheHandler(m.logger)
+	m.logger.Debug("Cache handler initialized")
+	return nil
+}
+
+// RegisterRoutes registers the module's routes
+func (m *Module) RegisterRoutes(e *echo.Echo, basePath string) {
+	m.logger.Info("Registering cache routes at %s/cache", basePath)
+	m.cacheHandler.RegisterRoutes(e, basePath)
+}
+
+// Migrations returns the module's migrations, the cache has no tables
+func (m *Module) Migrations() []migrate.Migration {
+	return nil
+}
+
+// Logger returns the module's logger
+func (m *Module) Logger() *logger.Logger {
+	return m.logger
+}
+
+// NewModule creates a new cache module
+func NewModule() *Module {
+	return &Module{}
+}
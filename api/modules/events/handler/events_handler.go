@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/middleware"
+	"nanonime/internal/pkg/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// EventsHandler handles HTTP requests for inspecting the event bus.
+type EventsHandler struct {
+	event  *bus.EventBus
+	outbox *bus.Outbox
+	log    *logger.Logger
+	r      *utils.Response
+}
+
+// NewEventsHandler creates a new events handler. The dead letter endpoints
+// are only available when the bus has an outbox.
+func NewEventsHandler(log *logger.Logger, event *bus.EventBus) *EventsHandler {
+	return &EventsHandler{
+		event:  event,
+		outbox: event.Outbox(),
+		log:    log,
+		r:      &utils.Response{},
+	}
+}
+
+// ListSubscriptions returns the event types and patterns subscribed to, with
+// their handlers and queue depth, and the registered request handlers.
+func (h *EventsHandler) ListSubscriptions(c echo.Context) error {
+	return h.r.SuccessResponse(c, map[string]interface{}{
+		"subscriptions": h.event.Subscriptions(),
+		"requests":      h.event.Requests(),
+	}, "Subscriptions retrieved")
+}
+
+// Metrics returns the event bus metrics, in the Prometheus text format with
+// ?format=prometheus.
+func (h *EventsHandler) Metrics(c echo.Context) error {
+	snapshot := h.event.Snapshot()
+
+	if c.QueryParam("format") == "prometheus" {
+		c.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		return snapshot.WritePrometheus(c.Response())
+	}
+
+	return h.r.SuccessResponse(c, snapshot, "Event bus metrics retrieved")
+}
+
+// ListDeadLetters returns dead letters, newest first (?limit=&offset=).
+func (h *EventsHandler) ListDeadLetters(c echo.Context) error {
+	limit, err := queryInt(c, "limit", defaultPageSize)
+	if err != nil || limit <= 0 {
+		return h.r.BadRequestResponse(c, "Invalid limit")
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return h.r.BadRequestResponse(c, "Invalid offset")
+	}
+
+	letters, total, err := h.outbox.DeadLetters(c.Request().Context(), limit, offset)
+	if err != nil {
+		h.log.Error("Failed to list dead letters:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	return h.r.SuccessResponse(c, map[string]interface{}{
+		"items":  letters,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	}, "Dead letters retrieved")
+}
+
+// ReplayDeadLetter moves a dead letter back into the outbox.
+func (h *EventsHandler) ReplayDeadLetter(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return h.r.BadRequestResponse(c, "Invalid dead letter ID")
+	}
+
+	if err := h.outbox.Replay(c.Request().Context(), id); err != nil {
+		if errors.Is(err, bus.ErrDeadLetterNotFound) {
+			return h.r.NotFoundResponse(c, err.Error())
+		}
+		h.log.Error("Failed to replay dead letter:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	if principal, ok := middleware.GetPrincipal(c); ok {
+		h.log.Info("Dead letter replayed", "admin_id", principal.UserID, "id", id)
+	}
+
+	return h.r.SuccessResponse(c, nil, "Dead letter queued for delivery")
+}
+
+// DiscardDeadLetter deletes a dead letter.
+func (h *EventsHandler) DiscardDeadLetter(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return h.r.BadRequestResponse(c, "Invalid dead letter ID")
+	}
+
+	if err := h.outbox.Discard(c.Request().Context(), id); err != nil {
+		if errors.Is(err, bus.ErrDeadLetterNotFound) {
+			return h.r.NotFoundResponse(c, err.Error())
+		}
+		h.log.Error("Failed to discard dead letter:", err)
+		return h.r.InternalServerErrorResponse(c, err.Error())
+	}
+
+	if principal, ok := middleware.GetPrincipal(c); ok {
+		h.log.Info("Dead letter discarded", "admin_id", principal.UserID, "id", id)
+	}
+
+	return h.r.NoContentResponse(c)
+}
+
+// queryInt parses an optional integer query parameter.
+func queryInt(c echo.Context, name string, fallback int) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// RegisterRoutes sets up the events routes.
+func (h *EventsHandler) RegisterRoutes(e *echo.Echo, basePath string) {
+	group := e.Group(basePath+"/events", middleware.Auth)
+	group.GET("/subscriptions", h.ListSubscriptions, middleware.RequirePermission(PermEventsRead))
+	group.GET("/metrics", h.Metrics, middleware.RequirePermission(PermEventsRead))
+
+	if h.outbox == nil {
+		return
+	}
+	group.GET("/dead-letters", h.ListDeadLetters, middleware.RequirePermission(PermEventsRead))
+	group.POST("/dead-letters/:id/replay", h.ReplayDeadLetter, middleware.RequirePermission(PermEventsReplay))
+	group.DELETE("/dead-letters/:id", h.DiscardDeadLetter, middleware.RequirePermission(PermEventsReplay))
+}
@@ -0,0 +1,14 @@
+package handler
+
+import "nanonime/internal/pkg/rbac"
+
+// Permissions declared by the events module
+const (
+	PermEventsRead   rbac.Permission = "events:read"
+	PermEventsReplay rbac.Permission = "events:replay"
+)
+
+// Permissions returns every permission declared by the events module
+func Permissions() []rbac.Permission {
+	return []rbac.Permission{PermEventsRead, PermEventsReplay}
+}
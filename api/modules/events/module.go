@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"nanonime/internal/contract/users"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/migrate"
+	"nanonime/internal/pkg/rbac"
+	"nanonime/internal/pkg/trace"
+	"nanonime/modules/events/handler"
+
+	"github.com/labstack/echo"
+	"gorm.io/gorm"
+)
+
+// Module implements the application Module interface for the events module,
+// which exposes admin endpoints for the event bus
+type Module struct {
+	logger        *logger.Logger
+	event         *bus.EventBus
+	eventsHandler *handler.EventsHandler
+	audit         *bus.Subscription
+}
+
+// Name returns the name of the module
+func (m *Module) Name() string {
+	return "events"
+}
+
+// Initialize initializes the module
+func (m *Module) Initialize(db *gorm.DB, log *logger.Logger, event *bus.EventBus) error {
+	m.logger = log
+	m.event = event
+
+	// Declare permissions, only admins may inspect events
+	rbac.Default.Grant(users.RoleAdmin, handler.Permissions()...)
+
+	// audit every event published on the bus
+	m.audit = event.SubscribeAll(bus.EventHandlerFunc(m.logEvent), bus.WithName("events.audit"), bus.WithLogger(m.logger))
+
+	if event.Outbox() == nil {
+		m.logger.Info("Event bus is in memory mode, dead letter endpoints disabled")
+	}
+
+	m.eventsHandler = handler.NewEventsHandler(m.logger, event)
+	m.logger.Debug("Events handler initialized")
+	return nil
+}
+
+// logEvent writes an audit log entry for an event
+func (m *Module) logEvent(e bus.Event) {
+	if sc, ok := trace.FromContext(e.Context()); ok {
+		m.logger.Debug("Event published", "event", e.Type, "trace_id", sc.TraceIDString())
+		return
+	}
+	m.logger.Debug("Event published", "event", e.Type)
+}
+
+// Stop detaches the audit subscription
+func (m *Module) Stop(ctx context.Context) error {
+	if m.audit != nil {
+		m.audit.Unsubscribe()
+	}
+	return nil
+}
+
+// RegisterRoutes registers the module's routes
+func (m *Module) RegisterRoutes(e *echo.Echo, basePath string) {
+	m.logger.Info("Registering events routes at %s/events", basePath)
+	m.eventsHandler.RegisterRoutes(e, basePath)
+}
+
+// Migrations returns the module's migrations, the outbox tables are
+// migrated by the application
+func (m *Module) Migrations() []migrate.Migration {
+	return nil
+}
+
+// Logger returns the module's logger
+func (m *Module) Logger() *logger.Logger {
+	return m.logger
+}
+
+// NewModule creates a new events module
+func NewModule() *Module {
+	return &Module{}
+}
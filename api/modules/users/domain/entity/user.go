@@ -1,18 +1,28 @@
 package entity
 
 import (
+	"nanonime/internal/contract/users"
 	"time"
 )
 
+// Roles
+const (
+	RoleAdmin = users.RoleAdmin
+	RoleUser  = users.RoleUser
+)
+
 // User represents a user entity
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Role      string    `json:"role" gorm:"type:enum('admin', 'user');default:'user'"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	Name            string     `json:"name"`
+	DisplayName     string     `json:"display_name" gorm:"size:100"`
+	AvatarURL       string     `json:"avatar_url" gorm:"size:512"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Role            string     `json:"role" gorm:"size:16;default:'user'"`
+	Password        string     `json:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 // TableName specifies the table name for User
@@ -20,6 +30,11 @@ func (*User) TableName() string {
 	return "users"
 }
 
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser
+}
+
 // NewUser creates a new user
 func NewUser(name, email, password string) *User {
 	now := time.Now()
@@ -27,6 +42,7 @@ func NewUser(name, email, password string) *User {
 		Name:      name,
 		Email:     email,
 		Password:  password,
+		Role:      RoleUser,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -5,12 +5,16 @@ import (
 	"nanonime/modules/users/domain/entity"
 )
 
-// UserRepository defines the user repository interface
+// UserRepository defines the user repository interface. Create, Update,
+// UpdateRole and Delete publish the matching user events.
 type UserRepository interface {
 	FindAll(ctx context.Context) ([]*entity.User, error)
 	FindByID(ctx context.Context, id uint) (*entity.User, error)
 	FindByEmail(ctx context.Context, email string) (*entity.User, error)
 	Create(ctx context.Context, user *entity.User) error
 	Update(ctx context.Context, user *entity.User) error
+	// UpdateRole saves user after a role change and also publishes
+	// UserRoleChanged
+	UpdateRole(ctx context.Context, user *entity.User) error
 	Delete(ctx context.Context, id uint) error
 }
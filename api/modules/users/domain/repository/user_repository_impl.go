@@ -3,24 +3,47 @@ package repository
 import (
 	"context"
 	"errors"
+	"nanonime/internal/pkg/bus"
 	"nanonime/internal/pkg/database"
 	"nanonime/modules/users/domain/entity"
+	"nanonime/modules/users/event"
+
+	"gorm.io/gorm"
 )
 
 var (
 	ERR_RECORD_NOT_FOUND = errors.New("record not found")
 )
 
-type UserRepositoryImpl struct{}
+// UserRepositoryImpl stores users with GORM. Writes publish their event with
+// bus.PublishTx in the same transaction, so the event is delivered exactly
+// when the change is committed.
+type UserRepositoryImpl struct {
+	event *bus.EventBus
+}
 
 // Create implements UserRepository.
 func (r UserRepositoryImpl) Create(ctx context.Context, user *entity.User) error {
-	return database.DB.WithContext(ctx).Create(user).Error
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return bus.PublishTx(r.event, tx, event.NewUserCreated(user))
+	})
 }
 
 // Delete implements UserRepository.
 func (r UserRepositoryImpl) Delete(ctx context.Context, id uint) error {
-	return database.DB.WithContext(ctx).Delete(&entity.User{}, id).Error
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user entity.User
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return bus.PublishTx(r.event, tx, event.NewUserDeleted(&user))
+	})
 }
 
 // FindAll finds all users
@@ -52,6 +75,9 @@ func (r UserRepositoryImpl) FindByID(ctx context.Context, id uint) (*entity.User
 	var user entity.User
 	result := database.DB.WithContext(ctx).First(&user, id)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
 		return nil, result.Error
 	}
 	return &user, nil
@@ -59,9 +85,28 @@ func (r UserRepositoryImpl) FindByID(ctx context.Context, id uint) (*entity.User
 
 // Update implements UserRepository.
 func (r UserRepositoryImpl) Update(ctx context.Context, user *entity.User) error {
-	return database.DB.WithContext(ctx).Save(user).Error
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		return bus.PublishTx(r.event, tx, event.NewUserUpdated(user))
+	})
+}
+
+// UpdateRole implements UserRepository.
+func (r UserRepositoryImpl) UpdateRole(ctx context.Context, user *entity.User) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		if err := bus.PublishTx(r.event, tx, event.NewUserUpdated(user)); err != nil {
+			return err
+		}
+		return bus.PublishTx(r.event, tx, event.NewUserRoleChanged(user))
+	})
 }
 
-func NewUserRepositoryImpl() UserRepository {
-	return UserRepositoryImpl{}
+// NewUserRepositoryImpl creates a repository publishing its events on event
+func NewUserRepositoryImpl(event *bus.EventBus) UserRepository {
+	return UserRepositoryImpl{event: event}
 }
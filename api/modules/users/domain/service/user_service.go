@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"nanonime/internal/pkg/utils"
 	"nanonime/modules/users/domain/entity"
 	"nanonime/modules/users/domain/repository"
 )
@@ -11,6 +12,8 @@ import (
 var (
 	ErrUserNotFound     = errors.New("user not found")
 	ErrEmailAlreadyUsed = errors.New("email already in use")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrInvalidPassword  = errors.New("invalid password")
 )
 
 // UserService handles user domain logic
@@ -42,6 +45,18 @@ func (s *UserService) GetUserByID(ctx context.Context, id uint) (*entity.User, e
 	return user, nil
 }
 
+// GetUserByEmail gets a user by email
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*entity.User, error) {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if err == repository.ERR_RECORD_NOT_FOUND {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
 // CreateUser creates a new user
 func (s *UserService) CreateUser(ctx context.Context, user *entity.User) error {
 	// existingUser, err := s.userRepo.FindByEmail(ctx, user.Email)
@@ -80,3 +95,62 @@ func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
 
 	return s.userRepo.Delete(ctx, id)
 }
+
+// ChangeRole changes the role of a user
+func (s *UserService) ChangeRole(ctx context.Context, id uint, role string) (*entity.User, error) {
+	if !entity.IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = role
+	if err := s.userRepo.UpdateRole(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateProfile updates the self-service fields of a user, nil values are left
+// unchanged
+func (s *UserService) UpdateProfile(ctx context.Context, id uint, name, displayName, avatarURL *string) (*entity.User, error) {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil {
+		user.Name = *name
+	}
+	if displayName != nil {
+		user.DisplayName = *displayName
+	}
+	if avatarURL != nil {
+		user.AvatarURL = *avatarURL
+	}
+
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DeleteAccount deletes a user after verifying their password
+func (s *UserService) DeleteAccount(ctx context.Context, id uint, password string) (*entity.User, error) {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.CompareHashAndPassword(user.Password, password) {
+		return nil, ErrInvalidPassword
+	}
+
+	if err := s.userRepo.Delete(ctx, id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -1,11 +1,5 @@
 package request
 
-// LoginRequest represents a request to login a user
-type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
-}
-
 // CreateUserRequest represents a request to create a user
 type CreateUserRequest struct {
 	Name     string `json:"name" validate:"required"`
@@ -20,7 +14,20 @@ type UpdateUserRequest struct {
 	Password string `json:"password" validate:"omitempty,min=6"`
 }
 
-type ChnagePasswordRequest struct {
-	Password        string `json:"password" validate:"required"`
-	ConfirmPassword string `json:"confirm_password" validate:"required, min=6"`
+// UpdateRoleRequest represents a request to change a user's role
+type UpdateRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin user"`
+}
+
+// UpdateProfileRequest represents a request to update the current user's
+// profile, omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=255"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitempty,url,max=512"`
+}
+
+// DeleteAccountRequest represents a request to delete the current user's account
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
 }
@@ -0,0 +1,52 @@
+// Package event builds the events published by the user module. Other
+// modules subscribe to them with bus.Subscribe and the types of
+// nanonime/internal/contract/users instead of matching on event names.
+package event
+
+import (
+	"nanonime/internal/contract/users"
+	"nanonime/modules/users/domain/entity"
+)
+
+// The events are declared by the user contract, so modules can subscribe to
+// them without importing this module
+type (
+	UserCreated     = users.UserCreated
+	UserUpdated     = users.UserUpdated
+	UserRoleChanged = users.UserRoleChanged
+	UserDeleted     = users.UserDeleted
+)
+
+// NewUserCreated builds the UserCreated event of user
+func NewUserCreated(user *entity.User) UserCreated {
+	return UserCreated{
+		ID:              user.ID,
+		Name:            user.Name,
+		Email:           user.Email,
+		Role:            user.Role,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+// NewUserUpdated builds the UserUpdated event of user
+func NewUserUpdated(user *entity.User) UserUpdated {
+	return UserUpdated{
+		ID:              user.ID,
+		Name:            user.Name,
+		Email:           user.Email,
+		Role:            user.Role,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}
+}
+
+// NewUserRoleChanged builds the UserRoleChanged event of user
+func NewUserRoleChanged(user *entity.User) UserRoleChanged {
+	return UserRoleChanged{ID: user.ID, Role: user.Role}
+}
+
+// NewUserDeleted builds the UserDeleted event of user
+func NewUserDeleted(user *entity.User) UserDeleted {
+	return UserDeleted{ID: user.ID, Email: user.Email}
+}
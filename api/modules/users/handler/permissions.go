@@ -0,0 +1,16 @@
+package handler
+
+import "nanonime/internal/pkg/rbac"
+
+// Permissions declared by the user module
+const (
+	PermUsersRead   rbac.Permission = "users:read"
+	PermUsersWrite  rbac.Permission = "users:write"
+	PermUsersDelete rbac.Permission = "users:delete"
+	PermUsersRoles  rbac.Permission = "users:roles"
+)
+
+// Permissions returns every permission declared by the user module
+func Permissions() []rbac.Permission {
+	return []rbac.Permission{PermUsersRead, PermUsersWrite, PermUsersDelete, PermUsersRoles}
+}
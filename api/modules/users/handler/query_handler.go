@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"nanonime/internal/contract/users"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/utils"
+	"nanonime/modules/users/domain/entity"
+	"nanonime/modules/users/domain/service"
+	"time"
+)
+
+// UserQueryHandler answers the bus requests declared in internal/contract/users
+type UserQueryHandler struct {
+	userService *service.UserService
+	event       *bus.EventBus
+}
+
+// NewUserQueryHandler creates a new user query handler
+func NewUserQueryHandler(event *bus.EventBus, userService *service.UserService) *UserQueryHandler {
+	return &UserQueryHandler{
+		userService: userService,
+		event:       event,
+	}
+}
+
+// Register registers the request handlers on the event bus
+func (h *UserQueryHandler) Register() error {
+	return errors.Join(
+		bus.HandleRequestFunc(h.event, h.FindByEmail),
+		bus.HandleRequestFunc(h.event, h.FindByID),
+		bus.HandleRequestFunc(h.event, h.Create),
+		bus.HandleRequestFunc(h.event, h.CheckPassword),
+		bus.HandleRequestFunc(h.event, h.SetPassword),
+		bus.HandleRequestFunc(h.event, h.VerifyEmail),
+	)
+}
+
+// FindByEmail answers users.FindUserByEmail
+func (h *UserQueryHandler) FindByEmail(ctx context.Context, q users.FindUserByEmail) (*users.Account, error) {
+	user, err := h.userService.GetUserByEmail(ctx, q.Email)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return account(user), nil
+}
+
+// FindByID answers users.FindUserByID
+func (h *UserQueryHandler) FindByID(ctx context.Context, q users.FindUserByID) (*users.Account, error) {
+	user, err := h.userService.GetUserByID(ctx, q.ID)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return account(user), nil
+}
+
+// Create answers users.CreateUser
+func (h *UserQueryHandler) Create(ctx context.Context, q users.CreateUser) (*users.Account, error) {
+	if q.Email == "" || q.PasswordHash == "" {
+		return nil, errors.New("email and password are required")
+	}
+
+	user := entity.NewUser(q.Name, q.Email, q.PasswordHash)
+	if err := h.userService.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return account(user), nil
+}
+
+// CheckPassword answers users.CheckPassword
+func (h *UserQueryHandler) CheckPassword(ctx context.Context, q users.CheckPassword) (*users.Account, error) {
+	var user *entity.User
+	var err error
+	if q.ID != 0 {
+		user, err = h.userService.GetUserByID(ctx, q.ID)
+	} else {
+		user, err = h.userService.GetUserByEmail(ctx, q.Email)
+	}
+	if err != nil {
+		return nil, queryError(err)
+	}
+
+	if !utils.CompareHashAndPassword(user.Password, q.Password) {
+		return nil, users.ErrInvalidPassword
+	}
+	return account(user), nil
+}
+
+// SetPassword answers users.SetPassword
+func (h *UserQueryHandler) SetPassword(ctx context.Context, q users.SetPassword) (*users.Account, error) {
+	if q.PasswordHash == "" {
+		return nil, errors.New("password is required")
+	}
+	return h.update(ctx, q.ID, func(user *entity.User) {
+		user.Password = q.PasswordHash
+	})
+}
+
+// VerifyEmail answers users.VerifyEmail
+func (h *UserQueryHandler) VerifyEmail(ctx context.Context, q users.VerifyEmail) (*users.Account, error) {
+	return h.update(ctx, q.ID, func(user *entity.User) {
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+	})
+}
+
+// update applies change to the user with id and saves it, the repository
+// publishes UserUpdated
+func (h *UserQueryHandler) update(ctx context.Context, id uint, change func(user *entity.User)) (*users.Account, error) {
+	user, err := h.userService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, queryError(err)
+	}
+
+	change(user)
+	if err := h.userService.UpdateUser(ctx, user); err != nil {
+		return nil, queryError(err)
+	}
+	return account(user), nil
+}
+
+// account converts a user entity to the reply of the user contract
+func account(user *entity.User) *users.Account {
+	return &users.Account{
+		ID:              user.ID,
+		Name:            user.Name,
+		Email:           user.Email,
+		Role:            user.Role,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+// queryError translates service errors into the errors of the user contract
+func queryError(err error) error {
+	if err == service.ErrUserNotFound {
+		return users.ErrUserNotFound
+	}
+	return err
+}
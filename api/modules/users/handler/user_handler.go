@@ -11,12 +11,26 @@ import (
 	"nanonime/modules/users/domain/service"
 	"nanonime/modules/users/dto/request"
 	"nanonime/modules/users/dto/response"
+	"nanonime/modules/users/event"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo"
 )
 
+// Tags of cached user responses, see middleware.PurgeCache
+const (
+	CacheTagUsers = "users"
+	CacheTagUser  = "user:{id}"
+)
+
+// UserCacheTags returns the tags of the cached responses showing a user
+func UserCacheTags(id uint) []string {
+	return []string{CacheTagUsers, strings.ReplaceAll(CacheTagUser, "{id}", strconv.FormatUint(uint64(id), 10))}
+}
+
 // UserHandler handles HTTP requests for users
 type UserHandler struct {
 	userService *service.UserService
@@ -34,8 +48,8 @@ func NewUserHandler(log *logger.Logger, event *bus.EventBus, userService *servic
 }
 
 // Event Bus Event user created
-func (h *UserHandler) Handle(event bus.Event) {
-	fmt.Printf("User created: %v", event.Payload)
+func (h *UserHandler) Handle(e event.UserCreated) {
+	fmt.Printf("User created: %v", e)
 }
 
 // GetAllUsers gets all users
@@ -92,9 +106,6 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
-	// event bus publish
-	h.event.Publish(bus.Event{Type: "user.created", Payload: user})
-
 	return c.JSON(http.StatusCreated, response.FromEntity(user))
 }
 
@@ -158,13 +169,135 @@ func (h *UserHandler) DeleteUser(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// GetMe gets the profile of the authenticated user
+func (h *UserHandler) GetMe(c echo.Context) error {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	user, err := h.userService.GetUserByID(c.Request().Context(), principal.UserID)
+	if err != nil {
+		if err == service.ErrUserNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, response.FromEntity(user))
+}
+
+// UpdateMe updates the profile of the authenticated user
+func (h *UserHandler) UpdateMe(c echo.Context) error {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	req := new(request.UpdateProfileRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	user, err := h.userService.UpdateProfile(c.Request().Context(), principal.UserID, req.Name, req.DisplayName, req.AvatarURL)
+	if err != nil {
+		if err == service.ErrUserNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, response.FromEntity(user))
+}
+
+// DeleteMe deletes the account of the authenticated user
+func (h *UserHandler) DeleteMe(c echo.Context) error {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	req := new(request.DeleteAccountRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	_, err := h.userService.DeleteAccount(c.Request().Context(), principal.UserID, req.Password)
+	if err != nil {
+		if err == service.ErrUserNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		if err == service.ErrInvalidPassword {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Invalid password"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ChangeRole changes the role of a user
+func (h *UserHandler) ChangeRole(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	req := new(request.UpdateRoleRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Admins cannot demote themselves and lock everyone out
+	if principal, ok := middleware.GetPrincipal(c); ok && principal.UserID == uint(id) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot change your own role"})
+	}
+
+	user, err := h.userService.ChangeRole(ctx, uint(id), req.Role)
+	if err != nil {
+		if err == service.ErrUserNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		if err == service.ErrInvalidRole {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid role"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	h.log.Info("User role changed", "user_id", user.ID, "role", user.Role)
+
+	return c.JSON(http.StatusOK, response.FromEntity(user))
+}
+
 // RegisterRoutes registers the user routes
 func (h *UserHandler) RegisterRoutes(e *echo.Echo, basePath string) {
 	group := e.Group(basePath+"/users", middleware.Auth)
 
-	group.GET("", h.GetAllUsers)
-	group.GET("/:id", h.GetUser)
-	group.POST("", h.CreateUser)
-	group.PUT("/:id", h.UpdateUser)
-	group.DELETE("/:id", h.DeleteUser)
+	// Self-service routes, available to every authenticated user
+	group.GET("/me", h.GetMe)
+	group.PATCH("/me", h.UpdateMe)
+	group.DELETE("/me", h.DeleteMe)
+
+	group.GET("", h.GetAllUsers, middleware.RequirePermission(PermUsersRead),
+		middleware.Cache(middleware.CacheOptions{TTL: time.Minute, Tags: []string{CacheTagUsers}}))
+	group.GET("/:id", h.GetUser, middleware.RequirePermission(PermUsersRead),
+		middleware.Cache(middleware.CacheOptions{TTL: 5 * time.Minute, Tags: []string{CacheTagUsers, CacheTagUser}}))
+	group.POST("", h.CreateUser, middleware.RequirePermission(PermUsersWrite))
+	group.PUT("/:id", h.UpdateUser, middleware.RequirePermission(PermUsersWrite))
+	group.DELETE("/:id", h.DeleteUser, middleware.RequirePermission(PermUsersDelete))
+	group.PUT("/:id/role", h.ChangeRole, middleware.RequirePermission(PermUsersRoles))
 }
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"encoding/json"
+	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/database"
+	"nanonime/internal/pkg/jwt"
+	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/middleware"
+	"nanonime/internal/pkg/utils"
+	"nanonime/internal/pkg/validator"
+	"nanonime/modules/users/domain/entity"
+	"nanonime/modules/users/domain/repository"
+	"nanonime/modules/users/domain/service"
+	"nanonime/modules/users/event"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type meFixture struct {
+	e     *echo.Echo
+	event *bus.EventBus
+	jwt   jwt.JWT
+	user  *entity.User
+}
+
+func newMeFixture(t *testing.T) *meFixture {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&entity.User{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+
+	password, err := utils.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := entity.NewUser("User", "user@example.com", password)
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	f := &meFixture{e: echo.New(), event: bus.NewEventBus(), jwt: jwt.NewJWTImpl("secret", time.Minute), user: user}
+	t.Cleanup(f.event.Close)
+	middleware.InitializeAuth(f.jwt)
+
+	f.e.Validator = validator.NewCustomValidator()
+	h := NewUserHandler(logger.Default(), f.event, service.NewUserService(repository.NewUserRepositoryImpl(f.event)))
+	h.RegisterRoutes(f.e, "/api")
+	return f
+}
+
+// do sends a request as the fixture's user, or anonymously when auth is false
+func (f *meFixture) do(t *testing.T, method, body string, auth bool) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/users/me", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if auth {
+		token, err := f.jwt.GenerateToken(jwt.Claims{UserID: f.user.ID, Email: f.user.Email, Role: f.user.Role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	f.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMe(t *testing.T) {
+	f := newMeFixture(t)
+
+	if rec := f.do(t, http.MethodGet, "", false); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+
+	rec := f.do(t, http.MethodGet, "", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var profile map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile["email"] != "user@example.com" || profile["password"] != nil {
+		t.Errorf("unexpected profile %v", profile)
+	}
+}
+
+func TestUpdateMe(t *testing.T) {
+	f := newMeFixture(t)
+
+	var updated []event.UserUpdated
+	bus.Subscribe(f.event, func(e event.UserUpdated) { updated = append(updated, e) })
+
+	if rec := f.do(t, http.MethodPatch, `{"avatar_url":"not a url"}`, true); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid avatar, got %d", rec.Code)
+	}
+
+	rec := f.do(t, http.MethodPatch, `{"display_name":"Neo","role":"admin"}`, true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var user entity.User
+	database.DB.First(&user, f.user.ID)
+	if user.DisplayName != "Neo" || user.Name != "User" {
+		t.Errorf("expected only the display name to change, got %+v", user)
+	}
+	if user.Role != entity.RoleUser {
+		t.Errorf("expected the role to be left alone, got %q", user.Role)
+	}
+
+	f.event.Wait()
+	if len(updated) != 1 || updated[0].ID != f.user.ID {
+		t.Errorf("expected one user.updated event, got %+v", updated)
+	}
+}
+
+func TestDeleteMe(t *testing.T) {
+	f := newMeFixture(t)
+
+	var deleted []event.UserDeleted
+	bus.Subscribe(f.event, func(e event.UserDeleted) { deleted = append(deleted, e) })
+
+	if rec := f.do(t, http.MethodDelete, `{"password":"wrong"}`, true); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a wrong password, got %d", rec.Code)
+	}
+
+	if rec := f.do(t, http.MethodDelete, `{"password":"secret"}`, true); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := f.do(t, http.MethodGet, "", true); rec.Code != http.StatusNotFound {
+		t.Errorf("expected the account to be gone, got %d", rec.Code)
+	}
+
+	f.event.Wait()
+	if len(deleted) != 1 || deleted[0].Email != "user@example.com" {
+		t.Errorf("expected one user.deleted event, got %+v", deleted)
+	}
+}
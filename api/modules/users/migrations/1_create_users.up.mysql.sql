@@ -0,0 +1,13 @@
+CREATE TABLE users (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name LONGTEXT,
+    display_name VARCHAR(100),
+    avatar_url VARCHAR(512),
+    email LONGTEXT,
+    email_verified_at DATETIME(3) NULL,
+    role ENUM('admin', 'user') DEFAULT 'user',
+    password LONGTEXT,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    PRIMARY KEY (id)
+);
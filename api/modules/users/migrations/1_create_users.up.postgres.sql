@@ -0,0 +1,12 @@
+CREATE TABLE users (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT,
+    display_name VARCHAR(100),
+    avatar_url VARCHAR(512),
+    email TEXT,
+    email_verified_at TIMESTAMPTZ,
+    role VARCHAR(16) DEFAULT 'user' CHECK (role IN ('admin', 'user')),
+    password TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
@@ -0,0 +1,13 @@
+-- Other drivers, e.g. sqlite in tests
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY,
+    name TEXT,
+    display_name VARCHAR(100),
+    avatar_url VARCHAR(512),
+    email TEXT,
+    email_verified_at DATETIME,
+    role VARCHAR(16) DEFAULT 'user' CHECK (role IN ('admin', 'user')),
+    password TEXT,
+    created_at DATETIME,
+    updated_at DATETIME
+);
@@ -1,17 +1,27 @@
 package user
 
 import (
+	"embed"
 	"nanonime/internal/pkg/bus"
+	"nanonime/internal/pkg/cache"
 	"nanonime/internal/pkg/logger"
+	"nanonime/internal/pkg/migrate"
+	"nanonime/internal/pkg/rbac"
 	"nanonime/modules/users/domain/entity"
 	"nanonime/modules/users/domain/repository"
 	"nanonime/modules/users/domain/service"
+	"nanonime/modules/users/event"
 	"nanonime/modules/users/handler"
 
 	"github.com/labstack/echo"
 	"gorm.io/gorm"
 )
 
+// migrations are the SQL scripts of the module's schema, by driver
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
 // Module implements the application Module interface for the user module
 type Module struct {
 	db          *gorm.DB
@@ -35,7 +45,7 @@ func (m *Module) Initialize(db *gorm.DB, log *logger.Logger, event *bus.EventBus
 	m.logger.Info("Initializing user module")
 
 	// Initialize repositories
-	userRepo := repository.NewUserRepositoryImpl()
+	userRepo := repository.NewUserRepositoryImpl(m.event)
 	m.logger.Debug("User repository initialized")
 
 	// Initialize services
@@ -46,14 +56,36 @@ func (m *Module) Initialize(db *gorm.DB, log *logger.Logger, event *bus.EventBus
 	m.userHandler = handler.NewUserHandler(m.logger, m.event, m.userService)
 	m.logger.Debug("User handler initialized")
 
+	// Answer requests of other modules
+	if err := handler.NewUserQueryHandler(m.event, m.userService).Register(); err != nil {
+		return err
+	}
+	m.logger.Debug("User query handlers registered")
+
+	// Declare permissions, only admins may manage users
+	rbac.Default.Grant(entity.RoleAdmin, handler.Permissions()...)
+
 	// register event listeners
 	m.logger.Info("Registering user module event listeners")
-	m.event.SubscribeFunc("user.created", m.userHandler.Handle)
+	bus.Subscribe(m.event, m.userHandler.Handle, bus.WithLogger(m.logger))
 
 	m.logger.Info("User module initialized successfully")
 	return nil
 }
 
+// DeclareInvalidations evicts cached user responses when users change
+func (m *Module) DeclareInvalidations(invalidator *cache.Invalidator) {
+	cache.InvalidateOn(invalidator, func(e event.UserCreated) []string {
+		return []string{handler.CacheTagUsers}
+	})
+	cache.InvalidateOn(invalidator, func(e event.UserUpdated) []string {
+		return handler.UserCacheTags(e.ID)
+	})
+	cache.InvalidateOn(invalidator, func(e event.UserDeleted) []string {
+		return handler.UserCacheTags(e.ID)
+	})
+}
+
 // RegisterRoutes registers the module's routes
 func (m *Module) RegisterRoutes(e *echo.Echo, basePath string) {
 	m.logger.Info("Registering user routes at %s/users", basePath)
@@ -62,9 +94,8 @@ func (m *Module) RegisterRoutes(e *echo.Echo, basePath string) {
 }
 
 // Migrations returns the module's migrations
-func (m *Module) Migrations() error {
-	m.logger.Info("Registering user module migrations")
-	return m.db.AutoMigrate(&entity.User{})
+func (m *Module) Migrations() []migrate.Migration {
+	return migrate.MustFromFS(migrations, "migrations")
 }
 
 // Logger returns the module's logger